@@ -0,0 +1,164 @@
+/*
+ Batch assembly, for when there's a whole class worth of submissions
+ to get through.  Files are assembled concurrently by a fixed number
+ of workers, each .hack written next to its .asm.
+*/
+
+package components
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// BatchResult is the outcome of assembling one file.
+type BatchResult struct {
+	Path     string
+	Words    int
+	Warnings []string
+	Err      error
+}
+
+// BatchFiles finds the .asm files to assemble, either every one under
+// a directory or those matching a glob.
+func BatchFiles(pattern string) ([]string, error) {
+	var paths []string
+
+	if info, err := os.Stat(pattern); err == nil && info.IsDir() {
+		err := filepath.Walk(pattern, func(path string, info os.FileInfo, err error) error {
+			if err == nil && isAsmFile(path, info) {
+				paths = append(paths, path)
+			}
+			return err
+		})
+
+		return paths, err
+	}
+
+	matches, err := filepath.Glob(pattern)
+
+	for _, path := range matches {
+		if info, err := os.Stat(path); err == nil && isAsmFile(path, info) {
+			paths = append(paths, path)
+		}
+	}
+
+	sort.Strings(paths)
+
+	return paths, err
+}
+
+func isAsmFile(path string, info os.FileInfo) bool {
+	return !info.IsDir() && strings.ToLower(filepath.Ext(path)) == ".asm"
+}
+
+// AssembleFiles assembles each of paths, using up to workers at once,
+// and writes the results to .hack files alongside them.  Results are
+// in the same order as paths.
+func AssembleFiles(paths []string, workers int) []BatchResult {
+	results := make([]BatchResult, len(paths))
+	jobs := make(chan int)
+
+	var wg sync.WaitGroup
+
+	for w := 0; w < max(1, min(workers, len(paths))); w++ {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			for i := range jobs {
+				results[i] = assembleFile(paths[i])
+			}
+		}()
+	}
+
+	for i := range paths {
+		jobs <- i
+	}
+
+	close(jobs)
+	wg.Wait()
+
+	return results
+}
+
+// Nothing is written unless the whole file assembles.
+func assembleFile(path string) BatchResult {
+	result := BatchResult{Path: path}
+	b, err := ioutil.ReadFile(path)
+
+	if err != nil {
+		result.Err = err
+		return result
+	}
+
+	parser := NewParser(StartLexingAsm(string(b)))
+	result.Warnings = parser.Warnings
+
+	if parser.Error != nil {
+		result.Err = parser.Error
+		return result
+	}
+
+	var out bytes.Buffer
+
+	for s := range parser.Output {
+		fmt.Fprintln(&out, s)
+		result.Words++
+	}
+
+	if parser.Error != nil {
+		result.Err = parser.Error
+		return result
+	}
+
+	hack := strings.TrimSuffix(path, filepath.Ext(path)) + ".hack"
+	result.Err = ioutil.WriteFile(hack, out.Bytes(), 0644)
+
+	return result
+}
+
+// WriteBatchSummary writes a line per file, then the totals, and
+// returns the number that failed.
+func WriteBatchSummary(w io.Writer, results []BatchResult) int {
+	width := len("File")
+
+	for _, r := range results {
+		width = max(width, len(r.Path))
+	}
+
+	failed := 0
+	warnings := 0
+
+	fmt.Fprintf(w, "%-*s  %-6s  %8s  %6s\n", width, "File", "Result", "Warnings", "Words")
+
+	for _, r := range results {
+		warnings += len(r.Warnings)
+
+		if r.Err != nil {
+			failed++
+			fmt.Fprintf(w, "%-*s  %-6s  %8d  %6s\n", width, r.Path, "FAILED", len(r.Warnings), "-")
+			continue
+		}
+
+		fmt.Fprintf(w, "%-*s  %-6s  %8d  %6d\n", width, r.Path, "ok", len(r.Warnings), r.Words)
+	}
+
+	fmt.Fprintf(w, "\n%d assembled, %d failed, %d warnings\n", len(results)-failed, failed, warnings)
+
+	for _, r := range results {
+		if r.Err != nil {
+			fmt.Fprintf(w, "\n%s:\n%s\n", r.Path, r.Err)
+		}
+	}
+
+	return failed
+}
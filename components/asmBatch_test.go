@@ -0,0 +1,92 @@
+package components
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestAssembleFiles(t *testing.T) {
+	dir, err := ioutil.TempDir("", "n2t-batch")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.RemoveAll(dir)
+
+	sources := map[string]string{
+		"a/good.asm":    sumSource,
+		"b/warning.asm": "@1\n@2\nD=A",
+		"c/broken.asm":  "@1\nD=Q",
+		"c/notes.txt":   "not assembly",
+	}
+
+	for name, source := range sources {
+		path := filepath.Join(dir, name)
+		os.MkdirAll(filepath.Dir(path), 0755)
+
+		if err := ioutil.WriteFile(path, []byte(source), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	paths, err := BatchFiles(dir)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(paths) != 3 {
+		t.Fatalf("Expected the three .asm files, got %v", paths)
+	}
+
+	if globbed, _ := BatchFiles(filepath.Join(dir, "*", "*.asm")); strings.Join(globbed, " ") != strings.Join(paths, " ") {
+		t.Errorf("Expected the glob to find %v, got %v", paths, globbed)
+	}
+
+	if globbed, _ := BatchFiles(filepath.Join(dir, "*", "*")); strings.Join(globbed, " ") != strings.Join(paths, " ") {
+		t.Errorf("Expected a glob to only find .asm files, %v, got %v", paths, globbed)
+	}
+
+	results := AssembleFiles(paths, 2)
+
+	for i, r := range results {
+		if r.Path != paths[i] {
+			t.Errorf("Result %d is for %s, expected %s", i, r.Path, paths[i])
+		}
+	}
+
+	if results[0].Err != nil || results[0].Words != 24 {
+		t.Errorf("Expected good.asm to assemble to 24 words, got %+v", results[0])
+	}
+
+	if results[1].Err != nil || len(results[1].Warnings) != 1 {
+		t.Errorf("Expected warning.asm to assemble with a warning, got %+v", results[1])
+	}
+
+	if results[2].Err == nil {
+		t.Errorf("Expected broken.asm to fail")
+	}
+
+	if _, err := os.Stat(filepath.Join(dir, "a", "good.hack")); err != nil {
+		t.Errorf("Expected good.hack to be written: %s", err)
+	}
+
+	if _, err := os.Stat(filepath.Join(dir, "c", "broken.hack")); err == nil {
+		t.Errorf("Expected nothing to be written for broken.asm")
+	}
+
+	var b bytes.Buffer
+
+	if failed := WriteBatchSummary(&b, results); failed != 1 {
+		t.Errorf("Expected one failure, got %d", failed)
+	}
+
+	if !strings.Contains(b.String(), "2 assembled, 1 failed, 1 warnings") {
+		t.Errorf("Unexpected summary:\n%s", b.String())
+	}
+}
@@ -0,0 +1,203 @@
+/*
+ Control flow graphs.  A program is split into basic blocks, runs of
+ instructions that are only ever entered at the top and left at the
+ bottom; a new block starts at each label and after each jump.  A jump's
+ target is known when the instruction before it loads A, e.g. @LOOP
+ then 0;JMP, anything else (A=M;JMP, say) is an indirect jump whose
+ target can't be known without running the program.
+*/
+
+package components
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// BasicBlock is a range of ROM addresses along with where control can
+// go from the end of it.
+type BasicBlock struct {
+	Start    int
+	End      int // exclusive
+	Label    string
+	Succs    []int // indexes of the blocks that can follow this one
+	Indirect bool  // ends with a jump to somewhere unknown
+}
+
+// CFG is a program's control flow graph, with blocks in address order.
+type CFG struct {
+	Blocks  []BasicBlock
+	program *Program
+}
+
+// CFG builds the program's control flow graph.
+func (p *Program) CFG() *CFG {
+	size := p.Size()
+	leaders := map[int]bool{0: true}
+
+	for _, addr := range p.Labels {
+		leaders[addr] = true
+	}
+
+	for addr := range p.jumps {
+		leaders[addr+1] = true
+
+		if target, ok := p.jumpTarget(addr); ok {
+			leaders[target] = true
+		}
+	}
+
+	var starts []int
+
+	for addr := range leaders {
+		if addr < size {
+			starts = append(starts, addr)
+		}
+	}
+
+	sort.Ints(starts)
+
+	g := CFG{program: p}
+	blockAt := make(map[int]int)
+
+	for i, start := range starts {
+		end := size
+
+		if i+1 < len(starts) {
+			end = starts[i+1]
+		}
+
+		label, _ := p.LabelAt(start)
+		blockAt[start] = i
+		g.Blocks = append(g.Blocks, BasicBlock{Start: start, End: end, Label: label})
+	}
+
+	for i := range g.Blocks {
+		b := &g.Blocks[i]
+		last := b.End - 1
+		jump, jumps := p.jumps[last]
+
+		if jumps {
+			target, ok := p.jumpTarget(last)
+
+			switch {
+			case !ok || last == b.Start:
+				b.Indirect = true
+			case target < size:
+				b.Succs = append(b.Succs, blockAt[target])
+			}
+		}
+
+		// a target of the next block is already there
+		if (!jumps || jump != "JMP") && i+1 < len(g.Blocks) && !b.follows(i+1) {
+			b.Succs = append(b.Succs, i+1)
+		}
+	}
+
+	return &g
+}
+
+// Where the jump at addr goes, if A is loaded just before it.  A jump
+// at the start of a block could be reached with anything in A.
+func (p *Program) jumpTarget(addr int) (int, bool) {
+	if addr == 0 || p.words[addr-1]&cInst == cInst {
+		return 0, false
+	}
+
+	return int(p.words[addr-1]), true
+}
+
+func (b *BasicBlock) follows(i int) bool {
+	for _, s := range b.Succs {
+		if s == i {
+			return true
+		}
+	}
+
+	return false
+}
+
+// WriteDOT writes the graph in Graphviz's DOT language.  Given a
+// profiler, each block shows the cycles spent in it and is shaded by
+// how hot it is.
+func (g *CFG) WriteDOT(w io.Writer, prof *Profiler) error {
+	b := bufio.NewWriter(w)
+	cycles := make([]int, len(g.Blocks))
+	hottest := 1
+
+	if prof != nil {
+		for i, block := range g.Blocks {
+			for addr := block.Start; addr < block.End; addr++ {
+				cycles[i] += prof.Cycles(addr)
+			}
+
+			hottest = max(hottest, cycles[i])
+		}
+	}
+
+	fmt.Fprintln(b, "digraph cfg {")
+	fmt.Fprintln(b, "\tnode [shape=box, fontname=monospace];")
+
+	indirect := false
+
+	for i, block := range g.Blocks {
+		attrs := fmt.Sprintf("label=\"%s\"", g.describe(block))
+
+		if prof != nil {
+			attrs += fmt.Sprintf(", xlabel=\"%d cycles\", style=filled, fillcolor=\"0.0 %.3f 1.0\"",
+				cycles[i], float64(cycles[i])/float64(hottest))
+		}
+
+		fmt.Fprintf(b, "\tb%d [%s];\n", i, attrs)
+
+		for _, s := range block.Succs {
+			fmt.Fprintf(b, "\tb%d -> b%d;\n", i, s)
+		}
+
+		if block.Indirect {
+			fmt.Fprintf(b, "\tb%d -> indirect [style=dashed];\n", i)
+			indirect = true
+		}
+	}
+
+	if indirect {
+		fmt.Fprintln(b, "\tindirect [label=\"?\", shape=circle];")
+	}
+
+	fmt.Fprintln(b, "}")
+
+	return b.Flush()
+}
+
+// A block's label and instructions, as source where it's known,
+// left-aligned for DOT.
+func (g *CFG) describe(block BasicBlock) string {
+	var lines []string
+
+	if block.Label != "" {
+		lines = append(lines, "("+block.Label+")")
+	}
+
+	for addr := block.Start; addr < block.End; addr++ {
+		text := disassemble(g.program.words[addr])
+
+		if _, src, ok := g.program.SourceLine(addr); ok {
+			if i := strings.Index(src, "//"); i >= 0 {
+				src = strings.TrimSpace(src[:i])
+			}
+
+			if src != "" {
+				text = src
+			}
+		}
+
+		lines = append(lines, fmt.Sprintf("%5d  %s", addr, text))
+	}
+
+	escaped := strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(strings.Join(lines, "\n"))
+
+	return strings.Replace(escaped, "\n", `\l`, -1) + `\l`
+}
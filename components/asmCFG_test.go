@@ -0,0 +1,97 @@
+package components
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestCFG(t *testing.T) {
+	prog, err := AssembleProgram(sumSource)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	g := prog.CFG()
+
+	expected := []BasicBlock{
+		{Start: 0, End: 4, Succs: []int{1}},
+		{Start: 4, End: 10, Label: "LOOP", Succs: []int{3, 2}},
+		{Start: 10, End: 18, Succs: []int{1}},
+		{Start: 18, End: 22, Label: "STOP", Succs: []int{4}},
+		{Start: 22, End: 24, Label: "END", Succs: []int{4}},
+	}
+
+	if len(g.Blocks) != len(expected) {
+		t.Fatalf("Expected %d blocks, got %+v", len(expected), g.Blocks)
+	}
+
+	for i, e := range expected {
+		b := g.Blocks[i]
+
+		if b.Start != e.Start || b.End != e.End || b.Label != e.Label || b.Indirect ||
+			fmt.Sprint(b.Succs) != fmt.Sprint(e.Succs) {
+			t.Errorf("Block %d: expected %+v, got %+v", i, e, b)
+		}
+	}
+}
+
+func TestCFGIndirect(t *testing.T) {
+	prog, err := AssembleProgram(linkLibrary)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	g := prog.CFG()
+	last := g.Blocks[len(g.Blocks)-1]
+
+	if last.Label != "MULT.done" || !last.Indirect || len(last.Succs) != 0 {
+		t.Errorf("Expected MULT.done to end with an indirect jump, got %+v", last)
+	}
+}
+
+func TestCFGWriteDOT(t *testing.T) {
+	prog, err := AssembleProgram(sumSource)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c := NewHackComputer()
+	c.LoadProgram(prog)
+	c.RAM[0] = 3
+
+	prof := NewProfiler(prog)
+	c.Observe(prof.Record)
+	c.Run(1000)
+
+	var b bytes.Buffer
+
+	if err := prog.CFG().WriteDOT(&b, prof); err != nil {
+		t.Fatal(err)
+	}
+
+	dot := b.String()
+
+	for _, expected := range []string{
+		"digraph cfg {",
+		`b1 [label="(LOOP)\l    4  @i\l`,
+		"b1 -> b3;",
+		"b2 -> b1;",
+		"b4 -> b4;",
+	} {
+		if !strings.Contains(dot, expected) {
+			t.Errorf("Expected %q in:\n%s", expected, dot)
+		}
+	}
+
+	// eight instructions in the loop body, run three times
+	for _, line := range strings.Split(dot, "\n") {
+		if strings.HasPrefix(line, "\tb2 [") && !strings.Contains(line, `xlabel="24 cycles"`) {
+			t.Errorf("Expected 24 cycles in the loop body, got %s", line)
+		}
+	}
+}
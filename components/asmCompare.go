@@ -0,0 +1,82 @@
+package components
+
+import (
+	"fmt"
+	"io"
+	"strings"
+)
+
+// HackDifference is an address where a program and a reference .hack
+// file disagree.
+type HackDifference struct {
+	Addr          int
+	Got, Expected asm
+	Missing       bool // the reference is longer than the program
+	Extra         bool // the program is longer than the reference
+}
+
+// compare lists the addresses where the program differs from
+// reference.
+func (p *Program) compare(reference []asm) []HackDifference {
+	var diffs []HackDifference
+
+	for addr := 0; addr < max(len(p.words), len(reference)); addr++ {
+		d := HackDifference{Addr: addr, Missing: addr >= len(p.words), Extra: addr >= len(reference)}
+
+		if !d.Missing {
+			d.Got = p.words[addr]
+		}
+
+		if !d.Extra {
+			d.Expected = reference[addr]
+		}
+
+		if d.Missing || d.Extra || d.Got != d.Expected {
+			diffs = append(diffs, d)
+		}
+	}
+
+	return diffs
+}
+
+// CompareHack lists the addresses where the program differs from the
+// reference .hack file read from r.
+func (p *Program) CompareHack(r io.Reader) ([]HackDifference, error) {
+	reference, err := readHack(r)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return p.compare(reference), nil
+}
+
+// WriteDifferences writes a line for each difference, with both
+// words, what they decode to and the source line the program's word
+// came from.
+func (p *Program) WriteDifferences(w io.Writer, diffs []HackDifference) {
+	for _, d := range diffs {
+		source := ""
+
+		if n, src, ok := p.SourceLine(d.Addr); ok {
+			source = fmt.Sprintf("  (line %d: %s)", n, src)
+		}
+
+		line := fmt.Sprintf("%5d  got %s  expected %s%s", d.Addr, describeWord(d.Got, d.Missing), describeWord(d.Expected, d.Extra), source)
+		fmt.Fprintln(w, strings.TrimRight(line, " "))
+	}
+
+	if len(diffs) == 0 {
+		fmt.Fprintln(w, "No differences.")
+	} else {
+		fmt.Fprintf(w, "%d differences.\n", len(diffs))
+	}
+}
+
+func describeWord(word asm, missing bool) string {
+	if missing {
+		return fmt.Sprintf("%-16s %-12s", "(nothing)", "")
+	}
+
+	return fmt.Sprintf("%.16b %-12s", word, disassemble(word))
+}
@@ -0,0 +1,51 @@
+package components
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestCompare(t *testing.T) {
+	prog, err := AssembleProgram("@5\nD=A\n@x\nM=D\n")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if diffs := prog.compare(prog.words); len(diffs) != 0 {
+		t.Errorf("Expected no differences with itself, got %+v", diffs)
+	}
+
+	// x at 17 rather than 16, and an extra word at the end
+	reference, err := readHack(strings.NewReader("0000000000000101\n1110110000010000\n0000000000010001\n1110001100001000\n0000000000000000\n"))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	diffs := prog.compare(reference)
+
+	expected := []HackDifference{
+		{Addr: 2, Got: 16, Expected: 17},
+		{Addr: 4, Missing: true},
+	}
+
+	if len(diffs) != len(expected) || diffs[0] != expected[0] || diffs[1] != expected[1] {
+		t.Fatalf("Expected %+v, got %+v", expected, diffs)
+	}
+
+	var b bytes.Buffer
+	prog.WriteDifferences(&b, diffs)
+	lines := strings.Split(b.String(), "\n")
+
+	for i, e := range []string{
+		"    2  got 0000000000010000 @16           expected 0000000000010001 @17           (line 3: @x)",
+		"    4  got (nothing)                      expected 0000000000000000 @0",
+		"2 differences.",
+	} {
+		if lines[i] != e {
+			t.Errorf("Line %d: expected\n%q\ngot\n%q", i, e, lines[i])
+		}
+	}
+}
@@ -0,0 +1,195 @@
+/*
+ Dead routine elimination.  Objects are split into routines at their
+ exported (global) labels, and only the routines that can be reached
+ from the start of the first object are kept.  A routine is reached if
+ a reached routine loads its address (whether to jump there or, say,
+ to store it as a return address), or if the routine before it is
+ reached and doesn't end with an unconditional jump, so execution can
+ fall into it.
+*/
+
+package components
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+type routine struct {
+	object     int
+	start, end int // offsets in the object's code, end is exclusive
+	names      []string
+}
+
+// RemoveDeadRoutines returns copies of objects without the routines
+// that can't be reached, along with a description of each removed
+// routine.
+func RemoveDeadRoutines(objects []*Object) ([]*Object, []string) {
+	routines := splitRoutines(objects)
+	reached := reachableRoutines(objects, routines)
+
+	var removed []string
+	var stripped []*Object
+
+	for i, o := range objects {
+		var kept []routine
+
+		for r, rt := range routines {
+			switch {
+			case rt.object != i:
+			case reached[r]:
+				kept = append(kept, rt)
+			case rt.end > rt.start:
+				removed = append(removed, fmt.Sprintf("%s: %s (%d words)", o.Name, rt.name(), rt.end-rt.start))
+			}
+		}
+
+		stripped = append(stripped, o.keep(kept))
+	}
+
+	return stripped, removed
+}
+
+func (rt routine) name() string {
+	if len(rt.names) == 0 {
+		return fmt.Sprintf("code at %d", rt.start)
+	}
+
+	return strings.Join(rt.names, ", ")
+}
+
+// Routines in the order they'll be laid out in ROM.
+func splitRoutines(objects []*Object) []routine {
+	var routines []routine
+
+	for i, o := range objects {
+		starts := map[int][]string{0: nil}
+
+		for name, offset := range o.Exports {
+			starts[offset] = append(starts[offset], name)
+		}
+
+		var offsets []int
+
+		for offset := range starts {
+			offsets = append(offsets, offset)
+		}
+
+		sort.Ints(offsets)
+
+		for n, offset := range offsets {
+			end := len(o.Code)
+
+			if n+1 < len(offsets) {
+				end = offsets[n+1]
+			}
+
+			names := starts[offset]
+			sort.Strings(names)
+			routines = append(routines, routine{i, offset, end, names})
+		}
+	}
+
+	return routines
+}
+
+func reachableRoutines(objects []*Object, routines []routine) []bool {
+	// which routine each object offset, and each export, belongs to
+	containing := func(object, offset int) int {
+		for r, rt := range routines {
+			if rt.object == object && offset >= rt.start && (offset < rt.end || offset == rt.start) {
+				return r
+			}
+		}
+		return -1
+	}
+
+	exported := make(map[string]int)
+
+	for r, rt := range routines {
+		for _, name := range rt.names {
+			exported[name] = r
+		}
+	}
+
+	reached := make([]bool, len(routines))
+	pending := []int{0}
+
+	for len(pending) > 0 {
+		r := pending[len(pending)-1]
+		pending = pending[:len(pending)-1]
+
+		if r < 0 || r >= len(routines) || reached[r] {
+			continue
+		}
+
+		reached[r] = true
+		rt := routines[r]
+		o := objects[rt.object]
+
+		for _, rel := range o.Relocs {
+			if rel.Offset < rt.start || rel.Offset >= rt.end {
+				continue
+			}
+
+			if rel.Symbol == "" {
+				pending = append(pending, containing(rt.object, int(o.Code[rel.Offset])))
+			} else if target, ok := exported[rel.Symbol]; ok {
+				pending = append(pending, target)
+			}
+		}
+
+		if rt.end == rt.start || !unconditionalJump(o.Code[rt.end-1]) {
+			pending = append(pending, r+1)
+		}
+	}
+
+	return reached
+}
+
+func unconditionalJump(i asm) bool {
+	return i&cInst == cInst && i&jmpJMP == jmpJMP
+}
+
+// A copy of the object with just the given routines, addresses within
+// it moved to match.
+func (o *Object) keep(routines []routine) *Object {
+	moved := make(map[int]int) // old offset to new, for every kept offset
+	kept := Object{Name: o.Name, Exports: make(map[string]int)}
+
+	for _, rt := range routines {
+		for offset := rt.start; offset < rt.end; offset++ {
+			moved[offset] = len(kept.Code)
+			kept.Code = append(kept.Code, o.Code[offset])
+		}
+
+		// labels at the very end of the object have no code of their own
+		if _, ok := moved[rt.start]; !ok {
+			moved[rt.start] = len(kept.Code)
+		}
+
+		for _, name := range rt.names {
+			kept.Exports[name] = moved[rt.start]
+		}
+	}
+
+	// as are local labels there, which are only ever relocations
+	moved[len(o.Code)] = len(kept.Code)
+
+	for _, r := range o.Relocs {
+		offset, ok := moved[r.Offset]
+
+		if !ok {
+			continue
+		}
+
+		if r.Symbol == "" {
+			kept.Code[offset] = aInst | asm(moved[int(o.Code[r.Offset])])
+		}
+
+		kept.Relocs = append(kept.Relocs, Relocation{offset, r.Symbol})
+	}
+
+	return &kept
+}
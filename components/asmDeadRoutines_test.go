@@ -0,0 +1,137 @@
+package components
+
+import (
+	"strings"
+	"testing"
+)
+
+// Never called, so should be dropped along with its loop.
+const linkUnused = `(DOUBLE)
+@x
+D=M
+M=D+M
+(.loop)
+@.loop
+0;JMP
+(HALF)
+@x
+M=M-1
+@return
+A=M
+0;JMP`
+
+// FALL has no jump at the end, so FALLEN is reached without being named.
+const linkFallThrough = `@FALL
+0;JMP
+(FALL)
+@x
+M=1
+(FALLEN)
+@y
+M=1
+(STOP)
+@STOP
+0;JMP
+(NEVER)
+@z
+M=1`
+
+func TestRemoveDeadRoutines(t *testing.T) {
+	objects := assembleObjects(t, linkMain, linkLibrary, linkUnused)
+	stripped, removed := RemoveDeadRoutines(objects)
+
+	if got := strings.Join(removed, "\n"); got != "c: DOUBLE (5 words)\nc: HALF (5 words)" {
+		t.Errorf("Unexpected routines removed:\n%s", got)
+	}
+
+	if len(stripped[2].Code) != 0 || len(stripped[2].Relocs) != 0 {
+		t.Errorf("Expected nothing left of c, got %+v", stripped[2])
+	}
+
+	words, err := Link(stripped)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// nothing was removed from the objects that are used
+	whole, err := Link(objects[:2])
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(words) != len(whole) {
+		t.Fatalf("Expected %d words, got %d", len(whole), len(words))
+	}
+
+	for i := range words {
+		if words[i] != whole[i] {
+			t.Errorf("Word %d: expected %.16b, got %.16b", i, whole[i], words[i])
+		}
+	}
+}
+
+func TestRemoveDeadRoutinesFallThrough(t *testing.T) {
+	objects := assembleObjects(t, linkFallThrough)
+	stripped, removed := RemoveDeadRoutines(objects)
+
+	if got := strings.Join(removed, "\n"); got != "a: NEVER (2 words)" {
+		t.Errorf("Unexpected routines removed:\n%s", got)
+	}
+
+	words, err := Link(stripped)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c := NewHackComputer()
+	c.loadWords(words)
+	c.Run(100)
+
+	if !c.Halted() || c.RAM[16] != 1 || c.RAM[17] != 1 {
+		t.Errorf("Expected x and y to be set, got %v (halted %t)", c.RAM[16:18], c.Halted())
+	}
+}
+
+// Moving code must move the labels that refer to it.
+func TestRemoveDeadRoutinesMovesLabels(t *testing.T) {
+	objects := assembleObjects(t, linkMain, linkUnused+"\n"+linkLibrary)
+	stripped, _ := RemoveDeadRoutines(objects)
+
+	if stripped[1].Exports["MULT"] != 0 {
+		t.Errorf("Expected MULT to move to 0, got %d", stripped[1].Exports["MULT"])
+	}
+
+	words, err := Link(stripped)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c := NewHackComputer()
+	c.loadWords(words)
+	c.Run(1000)
+
+	if !c.Halted() || c.RAM[19] != 42 {
+		t.Errorf("Expected 42 in result, got %d (halted %t)", c.RAM[19], c.Halted())
+	}
+}
+
+// A local label at the very end of an object is where the next object
+// starts, not address 0.
+func TestRemoveDeadRoutinesEndLabel(t *testing.T) {
+	objects := assembleObjects(t, "(MAIN)\n@.done\n0;JMP\n(.done)")
+	stripped, _ := RemoveDeadRoutines(objects)
+
+	words, err := Link(stripped)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(words) != 2 || words[0] != aInst|2 {
+		t.Errorf("Expected @2, got %v", words)
+	}
+}
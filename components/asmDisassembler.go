@@ -0,0 +1,55 @@
+package components
+
+import "fmt"
+
+////////////////////////////////////////////////////////////////////////////////
+// Reverse lookups of the instruction maps in asmInstructions.go
+////////////////////////////////////////////////////////////////////////////////
+
+var destNames = reverse(destMap)
+var jmpNames = reverse(jmpMap)
+var cmpNames = reverse(cmpMap)
+
+func reverse(m map[string]asm) map[asm]string {
+	r := make(map[asm]string, len(m))
+
+	for k, v := range m {
+		r[v] = k
+	}
+
+	return r
+}
+
+const destBits asm = 7 << 3
+const jmpBits asm = 7
+const cmpBits asm = 127 << 6
+
+// Disassembles a single instruction, e.g. @123 or AM=M-1;JGT, in a
+// form the assembler will turn back into the same instruction.  C
+// instructions with a comp part the assembler has no mnemonic for come
+// back as "???".
+func disassemble(i asm) string {
+	if i&cInst != cInst {
+		return fmt.Sprintf("@%d", i)
+	}
+
+	comp, ok := cmpNames[i&cmpBits]
+
+	if !ok {
+		return "???"
+	}
+
+	result := comp
+
+	// the assembler won't take a comp on its own, so null= stands in
+	// for the missing dest and jump
+	if d := i & destBits; d != 0 || i&jmpBits == 0 {
+		result = destNames[d] + "=" + result
+	}
+
+	if j := i & jmpBits; j != 0 {
+		result += ";" + jmpNames[j]
+	}
+
+	return result
+}
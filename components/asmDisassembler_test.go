@@ -0,0 +1,29 @@
+package components
+
+import "testing"
+
+func TestDisassembleEveryInstruction(t *testing.T) {
+	for comp, c := range cmpMap {
+		for dest, d := range destMap {
+			for jmp, j := range jmpMap {
+				src := comp
+
+				if dest != "null" || jmp == "null" {
+					src = dest + "=" + src
+				}
+
+				if jmp != "null" {
+					src += ";" + jmp
+				}
+
+				if dis := disassemble(cInst | c | d | j); dis != src {
+					t.Errorf("Expected %s, got %s", src, dis)
+				}
+			}
+		}
+	}
+
+	if dis := disassemble(aInst | 12345); dis != "@12345" {
+		t.Errorf("Expected @12345, got %s", dis)
+	}
+}
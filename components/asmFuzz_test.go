@@ -0,0 +1,112 @@
+package components
+
+import (
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+// Run with e.g. go test -fuzz FuzzLexer ./components, otherwise just
+// the seeds are tried.
+
+// Pieces of Pong.asm (the whole thing is too big to fuzz usefully),
+// and a few things that used to panic.
+func addSeeds(f *testing.F) {
+	source, err := ioutil.ReadFile("../Pong.asm")
+
+	if err != nil {
+		f.Fatal(err)
+	}
+
+	lines := strings.Split(string(source), "\n")
+
+	for i := 0; i < len(lines); i += 1000 {
+		f.Add(strings.Join(lines[i:min(i+40, len(lines))], "\n"))
+	}
+
+	for _, s := range []string{
+		"//",
+		"@1//",
+		"\r@x",
+		"@1\rD=Q",
+		"\n\n(X",
+		"D;JMP\r\n0;JMP\r\n",
+		"1:\n@1b\n@1f\n",
+		"00=0",
+		"null=0",
+		"@32768",
+	} {
+		f.Add(s)
+	}
+}
+
+func FuzzLexer(f *testing.F) {
+	addSeeds(f)
+
+	f.Fuzz(func(t *testing.T, source string) {
+		lines := strings.Count(source, "\n") + strings.Count(source, "\r") + 1
+
+		checkGoroutines(t, func() {
+			lexemes := 0
+
+			for lex := range StartLexingAsm(source) {
+				if lexemes++; lex.instruction == asmEOF {
+					continue
+				}
+
+				if lex.lineNum < 1 || lex.lineNum > lines {
+					t.Errorf("Lexeme outside of the source: %v", lex)
+				}
+			}
+
+			if lexemes == 0 {
+				t.Error("Expected at least an EOF")
+			}
+		})
+	})
+}
+
+func FuzzParser(f *testing.F) {
+	addSeeds(f)
+
+	f.Fuzz(func(t *testing.T, source string) {
+		var words []asm
+		var err error
+
+		checkGoroutines(t, func() { words, err = assemble(source) })
+
+		if err != nil {
+			return
+		}
+
+		for i, w := range words {
+			if w&cInst != cInst && w&(1<<15) != 0 {
+				t.Errorf("Word %d: %.16b is neither an A nor a C-instruction", i, w)
+			}
+		}
+
+		// assembling the disassembly gives the same program back
+		var b strings.Builder
+
+		for _, w := range words {
+			fmt.Fprintln(&b, disassemble(w))
+		}
+
+		again, err := assemble(b.String())
+
+		if err != nil {
+			t.Fatalf("Disassembly doesn't assemble: %s\n%s", err, b.String())
+		}
+
+		if len(again) != len(words) {
+			t.Fatalf("Expected %d words after round trip, got %d", len(words), len(again))
+		}
+
+		for i := range words {
+			if words[i] != again[i] {
+				t.Errorf("Word %d: %.16b became %.16b (%s)", i, words[i], again[i], disassemble(words[i]))
+			}
+		}
+	})
+}
@@ -33,11 +33,14 @@ var registers = map[string]asm{
 }
 
 var pointers = map[string]asm{
-	"SP":     0,
-	"LCL":    1,
-	"ARG":    2,
-	"THIS":   3,
-	"THAT":   4,
+	"SP":   0,
+	"LCL":  1,
+	"ARG":  2,
+	"THIS": 3,
+	"THAT": 4,
+}
+
+var constants = map[string]asm{
 	"SCREEN": 16384,
 	"KBD":    24576,
 }
@@ -99,7 +102,7 @@ var cmpMap = map[string]asm{
 	// A = 1
 	"M":   112 << 6,
 	"!M":  113 << 6,
-	"-M":  79 << 6,
+	"-M":  115 << 6,
 	"M+1": 119 << 6,
 	"M-1": 114 << 6,
 	"D+M": 66 << 6,
@@ -5,12 +5,15 @@
 
 package components
 
+import "context"
+
 ////////////////////////////////////////////////////////////////////////////////
 // character sets for various tokens (symbol, instruction etc)
 ////////////////////////////////////////////////////////////////////////////////
 
 const validSymbol string = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789_.$:-"
 const validInstruction string = "-+01!AMD&|nullJGELMNTQEP"
+const digits string = "0123456789"
 
 ////////////////////////////////////////////////////////////////////////////////
 // Here's where it all goes wrong....
@@ -18,7 +21,14 @@ const validInstruction string = "-+01!AMD&|nullJGELMNTQEP"
 
 func StartLexingAsm(input string) chan asmLexeme {
 
-	lex := newLexer(input)
+	return StartLexingAsmContext(context.Background(), input)
+}
+
+// As StartLexingAsm, but stops early (closing the channel without an
+// EOF) once ctx is done.
+func StartLexingAsmContext(ctx context.Context, input string) chan asmLexeme {
+
+	lex := newLexer(ctx, input)
 
 	lex.Run(initState)
 
@@ -37,18 +47,17 @@ func initState(l* lexer) stateFunction {
 
 	if l.atEOF() {
 		l.emit(asmEOF)
-		close(l.output)
 		return nil
 	}
 
 	if l.atEOL() {
 		l.emit(asmEOL)
 		l.skipEol()
-		return initState(l)
+		return initState
 	}
 
 	// determine what we're looking at
-	next := l.nextInstance("=;(@")
+	next := l.nextInstance("=;(@:")
 
 	switch next {
 	case "=":
@@ -62,6 +71,9 @@ func initState(l* lexer) stateFunction {
 		return atLabel(l)
 	case "@":
 		return atAInstruct(l)
+	case ":":
+		// numeric local label, e.g. 1:
+		return atNumericLabel(l)
 	default:
 		// anything else must be an error
 		return errorState(l)
@@ -152,6 +164,23 @@ func atLabel(l* lexer) stateFunction {
 	return endOfInstruction(l)
 }
 
+// Emitted as a label whose name is just the number, which can't be
+// confused with an ordinary label as those can't be referred to.
+func atNumericLabel(l* lexer) stateFunction {
+
+	l.accept(digits)
+	next := l.peek()
+
+	if l.nothingFound() || next != ":" {
+		return errorState(l)
+	}
+
+	l.emit(asmLABEL)
+	l.skipOne()
+
+	return endOfInstruction(l)
+}
+
 func endOfInstruction(l* lexer) stateFunction {
 
 	l.skipWhiteSpace()
@@ -160,7 +189,7 @@ func endOfInstruction(l* lexer) stateFunction {
 		return errorState(l)
 	}
 
-	return initState(l)
+	return initState
 }
 
 func errorState(l* lexer) stateFunction {
@@ -168,5 +197,5 @@ func errorState(l* lexer) stateFunction {
 	l.emit(asmERROR)
 	l.skipToEol()
 
-	return initState(l)
+	return initState
 }
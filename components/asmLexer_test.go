@@ -47,6 +47,17 @@ var asmTest = []struct {
 			{lineNum: 2, instruction: asmLABEL, value: "LOOP"},
 			{lineNum: 2, instruction: asmEOF, value: ""}}},
 
+	{"Local labels", "(.loop)\n  1:\n@1b\nx1:",
+		[]asmLexeme{
+			{lineNum: 1, instruction: asmLABEL, value: ".loop"},
+			{lineNum: 1, instruction: asmEOL, value: ""},
+			{lineNum: 2, instruction: asmLABEL, value: "1"},
+			{lineNum: 2, instruction: asmEOL, value: ""},
+			{lineNum: 3, instruction: asmAINSTRUCT, value: "1b"},
+			{lineNum: 3, instruction: asmEOL, value: ""},
+			{lineNum: 4, instruction: asmERROR, value: "x1:"},
+			{lineNum: 4, instruction: asmEOF, value: ""}}},
+
 	{"A-Instruction only", "@abc123",
 		[]asmLexeme{
 			{lineNum: 1, instruction: asmAINSTRUCT, value: "abc123"},
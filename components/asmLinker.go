@@ -0,0 +1,99 @@
+/*
+ Links objects into a single program.  Objects are laid out in ROM in
+ the order given, so the first one's code is where execution starts.
+*/
+
+package components
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+)
+
+// Link combines objects into a program, resolving imports against
+// the other objects' exports.  Imports that nothing exports are
+// variables, given addresses from 16 in order of first use across all
+// of the objects.
+func Link(objects []*Object) ([]asm, error) {
+	var errs errorList
+	var words []asm
+	bases := make([]int, len(objects))
+	exports := make(map[string]int)
+	exportedBy := make(map[string]string)
+
+	for i, o := range objects {
+		bases[i] = len(words)
+		words = append(words, o.Code...)
+
+		for name, offset := range o.Exports {
+			if other, dupe := exportedBy[name]; dupe {
+				errs = append(errs, fmt.Errorf("Label %s exported by both %s and %s", name, other, o.Name))
+			}
+
+			exports[name] = bases[i] + offset
+			exportedBy[name] = o.Name
+		}
+	}
+
+	if len(words) > romSize {
+		errs = append(errs, fmt.Errorf("Program is too big for ROM, %d instructions (maximum %d)", len(words), romSize))
+	}
+
+	if len(errs) > 0 {
+		return nil, errs.asError()
+	}
+
+	variables := make(map[string]int)
+	mem := 16
+
+	for i, o := range objects {
+		for _, r := range o.Relocs {
+			if r.Offset < 0 || r.Offset >= len(o.Code) {
+				errs = append(errs, fmt.Errorf("%s: relocation outside of the code, %d", o.Name, r.Offset))
+				continue
+			}
+
+			addr := bases[i] + r.Offset
+
+			if r.Symbol == "" {
+				words[addr] = aInst | asm(bases[i]+int(words[addr]))
+				continue
+			}
+
+			if label, ok := exports[r.Symbol]; ok {
+				words[addr] = aInst | asm(label)
+				continue
+			}
+
+			if _, ok := variables[r.Symbol]; !ok {
+				if mem == screenBase {
+					errs = append(errs, fmt.Errorf("Too many variables, %s would be at %d, the start of SCREEN", r.Symbol, mem))
+				}
+
+				variables[r.Symbol] = mem
+				mem++
+			}
+
+			words[addr] = aInst | asm(variables[r.Symbol])
+		}
+	}
+
+	if len(errs) > 0 {
+		return nil, errs.asError()
+	}
+
+	return words, nil
+}
+
+// WriteHack writes words in the .hack format, one binary string per
+// line.
+func WriteHack(w io.Writer, words []asm) error {
+	b := bufio.NewWriter(w)
+
+	for _, word := range words {
+		fmt.Fprintf(b, "%.16b\n", word)
+	}
+
+	return b.Flush()
+}
@@ -0,0 +1,164 @@
+package components
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+const linkMain = `// result = 6 * 7, via the library
+@6
+D=A
+@x
+M=D
+@7
+D=A
+@y
+M=D
+@END
+D=A
+@return
+M=D
+@MULT
+0;JMP
+(END)
+@END
+0;JMP`
+
+const linkLibrary = `// result = x * y, then jumps to return
+(MULT)
+@result
+M=0
+(.loop)
+@y
+D=M
+@.done
+D;JEQ
+@x
+D=M
+@result
+M=D+M
+@y
+M=M-1
+@.loop
+0;JMP
+(.done)
+@return
+A=M
+0;JMP`
+
+func assembleObjects(t *testing.T, sources ...string) []*Object {
+	var objects []*Object
+
+	for i, source := range sources {
+		obj, err := AssembleObject(string('a'+rune(i)), source)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		objects = append(objects, obj)
+	}
+
+	return objects
+}
+
+func TestLink(t *testing.T) {
+	objects := assembleObjects(t, linkMain, linkLibrary)
+
+	if imports := strings.Join(objects[0].Imports(), " "); imports != "x y return MULT" {
+		t.Errorf("Unexpected imports: %s", imports)
+	}
+
+	if _, ok := objects[1].Exports["MULT"]; !ok || len(objects[1].Exports) != 1 {
+		t.Errorf("Expected just MULT to be exported, got %v", objects[1].Exports)
+	}
+
+	words, err := Link(objects)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c := NewHackComputer()
+	c.loadWords(words)
+	c.Run(1000)
+
+	// variables in order of first use; x, y, return, then result
+	if !c.Halted() || c.RAM[19] != 42 {
+		t.Errorf("Expected 42 in result, got %d (halted %t)", c.RAM[19], c.Halted())
+	}
+
+	// linking both as one program gives the same result
+	whole, err := AssembleProgram(linkMain + "\n" + linkLibrary)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(whole.words) != len(words) {
+		t.Fatalf("Expected %d words, got %d", len(whole.words), len(words))
+	}
+
+	for i := range words {
+		if words[i] != whole.words[i] {
+			t.Errorf("Word %d: expected %.16b, got %.16b", i, whole.words[i], words[i])
+		}
+	}
+}
+
+func TestObjectFile(t *testing.T) {
+	obj := assembleObjects(t, linkLibrary)[0]
+
+	var b bytes.Buffer
+
+	if err := obj.Write(&b); err != nil {
+		t.Fatal(err)
+	}
+
+	read, err := ReadObject(&b, obj.Name)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(read.Code) != len(obj.Code) || len(read.Relocs) != len(obj.Relocs) || read.Exports["MULT"] != 0 {
+		t.Fatalf("Object changed after writing and reading, %+v", read)
+	}
+
+	for i := range obj.Relocs {
+		if read.Relocs[i] != obj.Relocs[i] {
+			t.Errorf("Relocation %d: expected %v, got %v", i, obj.Relocs[i], read.Relocs[i])
+		}
+	}
+
+	for _, tst := range badObjects {
+		_, err := ReadObject(strings.NewReader(tst.source), "bad")
+
+		if err == nil || err.Error() != tst.expected {
+			t.Errorf("%q: expected %q, got %v", tst.source, tst.expected, err)
+		}
+	}
+}
+
+var badObjects = []struct {
+	source   string
+	expected string
+}{
+	{"", "bad is not a Hack object file"},
+	{"0000000000000000\n", "bad is not a Hack object file"},
+	{objectHeader + "\nexport MULT 0\n", "bad has no code line"},
+	{objectHeader + "\nexport MULT 2\ncode\n0000000000000000\n", "bad: Export MULT is past the end of the code, offset 2 of 1 words"},
+	{objectHeader + "\nexport MULT -1\ncode\n", "bad, line 2: Invalid offset: -1"},
+	{objectHeader + "\ncode\n000000000000000\n", "bad, line 3: Invalid instruction: 000000000000000"},
+	{objectHeader + "\ncode\n0000000000000000 import\n", "bad, line 3: Unrecognised relocation: import"},
+	{objectHeader + "\nlink\ncode\n", "bad, line 2: Expected an export or code: link"},
+}
+
+func TestLinkErrors(t *testing.T) {
+	objects := assembleObjects(t, "(A)\n@A", "(A)\n@A")
+
+	if _, err := Link(objects); err == nil || !strings.Contains(err.Error(), "Label A exported by both a and b") {
+		t.Errorf("Expected a duplicate export error, got %v", err)
+	}
+}
@@ -0,0 +1,268 @@
+/*
+ Relocatable object files, so that library routines can be assembled
+ once and linked into any number of programs.  An object's code is
+ assembled as if it started at ROM 0, with relocations marking the
+ A-instructions that need fixing up once it's known where it'll go,
+ and which symbols it needs from elsewhere.
+
+ The file format is text, in the same spirit as .hack files:
+
+	// Hack object file
+	export MULT 0
+	code
+	0000000000000100 reloc
+	1110110000010000
+	0000000000000000 import result
+
+ Global labels are exported, local and numeric ones aren't.  An
+ imported symbol that no object exports is a variable, and is given
+ an address when linking.
+*/
+
+package components
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Object is an assembled but unlinked piece of code.
+type Object struct {
+	Name    string
+	Code    []asm
+	Exports map[string]int // offset from the start of Code of each global label
+	Relocs  []Relocation   // in order of Offset
+}
+
+// Relocation is an A-instruction whose value depends on where things
+// end up.
+type Relocation struct {
+	Offset int    // index into Code
+	Symbol string // imported symbol, or empty for an address within the object
+}
+
+const objectHeader = "// Hack object file"
+
+// AssembleObject assembles source into an object called name.
+func AssembleObject(name, source string) (*Object, error) {
+	parser := NewParser(StartLexingAsm(source))
+
+	if parser.Error != nil {
+		return nil, parser.Error
+	}
+
+	obj := Object{Name: name, Exports: make(map[string]int)}
+
+	for s := range parser.Output {
+		w, err := strconv.ParseUint(s, 2, 16)
+
+		if err != nil {
+			return nil, err
+		}
+
+		obj.Code = append(obj.Code, asm(w))
+	}
+
+	if parser.Error != nil {
+		return nil, parser.Error
+	}
+
+	for offset, name := range parser.refs {
+		sym, _ := parser.lookup(name)
+
+		switch sym.kind {
+		case symLabel:
+			obj.Relocs = append(obj.Relocs, Relocation{Offset: offset})
+
+		case symVariable:
+			obj.Code[offset] = aInst
+			obj.Relocs = append(obj.Relocs, Relocation{offset, name})
+		}
+	}
+
+	sort.Slice(obj.Relocs, func(i, j int) bool { return obj.Relocs[i].Offset < obj.Relocs[j].Offset })
+
+	for name, sym := range parser.symbols {
+		if sym.kind == symLabel && !sym.local {
+			obj.Exports[name] = int(sym.value)
+		}
+	}
+
+	return &obj, nil
+}
+
+// Imports returns the symbols the object needs from elsewhere, in
+// order of first use.
+func (o *Object) Imports() []string {
+	var imports []string
+	seen := make(map[string]bool)
+
+	for _, r := range o.Relocs {
+		if r.Symbol != "" && !seen[r.Symbol] {
+			seen[r.Symbol] = true
+			imports = append(imports, r.Symbol)
+		}
+	}
+
+	return imports
+}
+
+// Write writes the object in the object file format.
+func (o *Object) Write(w io.Writer) error {
+	b := bufio.NewWriter(w)
+	fmt.Fprintln(b, objectHeader)
+
+	var exports []string
+
+	for name := range o.Exports {
+		exports = append(exports, name)
+	}
+
+	sort.Strings(exports)
+
+	for _, name := range exports {
+		fmt.Fprintf(b, "export %s %d\n", name, o.Exports[name])
+	}
+
+	fmt.Fprintln(b, "code")
+
+	relocs := make(map[int]Relocation)
+
+	for _, r := range o.Relocs {
+		relocs[r.Offset] = r
+	}
+
+	for i, word := range o.Code {
+		r, ok := relocs[i]
+
+		switch {
+		case !ok:
+			fmt.Fprintf(b, "%.16b\n", word)
+		case r.Symbol == "":
+			fmt.Fprintf(b, "%.16b reloc\n", word)
+		default:
+			fmt.Fprintf(b, "%.16b import %s\n", word, r.Symbol)
+		}
+	}
+
+	return b.Flush()
+}
+
+// ReadObject reads an object file, naming the object name.
+func ReadObject(r io.Reader, name string) (*Object, error) {
+	obj := Object{Name: name, Exports: make(map[string]int)}
+	scanner := bufio.NewScanner(r)
+	lineNum := 0
+	inCode := false
+
+	for scanner.Scan() {
+		lineNum++
+		line := strings.TrimSpace(scanner.Text())
+
+		if lineNum == 1 {
+			if line != objectHeader {
+				return nil, fmt.Errorf("%s is not a Hack object file", name)
+			}
+			continue
+		}
+
+		words := strings.Fields(line)
+
+		if err := obj.readLine(words, inCode); err != nil {
+			return nil, fmt.Errorf("%s, line %d: %s", name, lineNum, err)
+		}
+
+		inCode = inCode || (len(words) == 1 && words[0] == "code")
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	if lineNum == 0 {
+		return nil, fmt.Errorf("%s is not a Hack object file", name)
+	}
+
+	if !inCode {
+		return nil, fmt.Errorf("%s has no code line", name)
+	}
+
+	if err := obj.checkExports(); err != nil {
+		return nil, fmt.Errorf("%s: %s", name, err)
+	}
+
+	return &obj, nil
+}
+
+// An export can be the end of the code (a label after the last
+// instruction), but not beyond it.
+func (o *Object) checkExports() error {
+	names := make([]string, 0, len(o.Exports))
+
+	for name := range o.Exports {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	for _, name := range names {
+		if o.Exports[name] > len(o.Code) {
+			return fmt.Errorf("Export %s is past the end of the code, offset %d of %d words", name, o.Exports[name], len(o.Code))
+		}
+	}
+
+	return nil
+}
+
+func (o *Object) readLine(words []string, inCode bool) error {
+	if len(words) == 0 {
+		return nil
+	}
+
+	if !inCode {
+		switch {
+		case len(words) == 1 && words[0] == "code":
+			return nil
+
+		case len(words) == 3 && words[0] == "export":
+			offset, err := strconv.Atoi(words[2])
+
+			if err != nil || offset < 0 {
+				return fmt.Errorf("Invalid offset: %s", words[2])
+			}
+
+			o.Exports[words[1]] = offset
+			return nil
+		}
+
+		return fmt.Errorf("Expected an export or code: %s", strings.Join(words, " "))
+	}
+
+	w, err := strconv.ParseUint(words[0], 2, 16)
+
+	if err != nil || len(words[0]) != 16 {
+		return fmt.Errorf("Invalid instruction: %s", words[0])
+	}
+
+	offset := len(o.Code)
+	o.Code = append(o.Code, asm(w))
+
+	switch {
+	case len(words) == 1:
+		return nil
+
+	case len(words) == 2 && words[1] == "reloc":
+		o.Relocs = append(o.Relocs, Relocation{Offset: offset})
+		return nil
+
+	case len(words) == 3 && words[1] == "import":
+		o.Relocs = append(o.Relocs, Relocation{offset, words[2]})
+		return nil
+	}
+
+	return fmt.Errorf("Unrecognised relocation: %s", strings.Join(words[1:], " "))
+}
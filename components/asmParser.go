@@ -1,9 +1,9 @@
 package components
 
 import (
+	"context"
 	"errors"
 	"fmt"
-	"os"
 	"strconv"
 )
 
@@ -14,67 +14,137 @@ type AsmParser struct {
 	items  chan asmLexeme
 	Output chan string
 	symbolTable
-	lexemes []asmLexeme
-	Error   error
+	lexemes  []asmLexeme
+	lines    []int          // source line of each instruction
+	refs     map[int]string // symbol used by each A-instruction that uses one
+	jumps    map[int]string // jump mnemonic of each C-instruction that has one
+	words    []asm          // the instructions, once both passes are done
+	Error    error
+	Warnings []string        // from the first pass, so available straight away
+	ctx      context.Context // cancels both passes and the writing of Output
+	cancel   context.CancelFunc
 }
 
 const maxConst = 32768 // 2^15
 
-// NewParser creates a new instance of AsmParser, kicks off the
-// process by running the first pass (to build symbol table) and
-// returns the parser.  Any errors encountered during the first
-// pass will be attached to the Error field.
-func NewParser(input chan asmLexeme) AsmParser {
+// NewParser creates a new instance of AsmParser, runs the first pass
+// (to build the symbol table) and the second (mapping instructions),
+// then returns the parser with its instructions being passed back on
+// the Output channel.  Any errors are attached to the Error field
+// before it returns, in which case nothing is written to Output.  It
+// returns a pointer, as Error can still change if the parser is
+// closed before Output's been read to the end.
+func NewParser(input chan asmLexeme) *AsmParser {
+	return NewParserContext(context.Background(), input)
+}
+
+// NewParserContext is NewParser, giving up with ctx's error if it's
+// done before both passes are, or before Output's been written.
+// Output is always closed, including early once ctx is done, so a
+// consumer that stops reading before the end should cancel ctx (or
+// call Close) rather than leave it waiting forever.
+func NewParserContext(ctx context.Context, input chan asmLexeme) *AsmParser {
+	ctx, cancel := context.WithCancel(ctx)
 
 	parser := AsmParser{
 		items:       input,
 		Output:      make(chan string),
 		symbolTable: newSymbolTable(),
+		refs:        make(map[int]string),
+		jumps:       make(map[int]string),
+		ctx:         ctx,
+		cancel:      cancel,
 	}
 
-	// first pass, building symbol table and recording errors
-	parser.buildSymbols()
+	parser.parse()
 
 	if parser.Error == nil {
 		go parser.run()
+	} else {
+		close(parser.Output)
+		cancel()
 	}
 
-	return parser
+	return &parser
 }
 
-// Run is badly named and is about to be changed.  Note that the Lexer
-// is actually doing a lot of error checking, so can assume at this
-// point that, while that may they not be correctly spelled, we're not
-// going to get more than one jmp per line etc, or more than three
-// parts (d=c;j) per line.  So this isn't really a parser, it just
-// maps instruction mnemonics.
-//
-// At the first error will stop writing to the output channel, but
-// sill continue to parse the rest of the lexemes, so that a full list
-// of errors can still be returned.
+// Close stops the parser writing to Output, for a consumer that
+// doesn't read it to the end.  Output is closed once it's stopped, and
+// Error is then context.Canceled.  Closing a parser that's finished
+// does nothing.
+func (p *AsmParser) Close() {
+	p.cancel()
+}
+
+// Both passes, with any panic turned into an error.  If the first
+// pass stops before the lexer's finished, the rest of the lexemes are
+// read and thrown away so that the lexer isn't left waiting.
+func (p *AsmParser) parse() {
+	defer func() {
+		if r := recover(); r != nil {
+			p.Error = fmt.Errorf("Parser panic: %v", r)
+			go drain(p.items)
+		}
+	}()
+
+	// first pass, building symbol table and recording errors
+	p.buildSymbols()
+
+	if p.Error == nil {
+		p.translate()
+	}
+}
+
+// Writes the instructions to Output, stopping early with the
+// context's error if it's done.
 func (p *AsmParser) run() {
+	defer p.cancel()
 	defer close(p.Output)
 
+	for _, w := range p.words {
+		select {
+		case p.Output <- fmt.Sprintf("%.16b", w):
+		case <-p.ctx.Done():
+			p.Error = p.ctx.Err()
+			return
+		}
+	}
+}
+
+// Second pass.  Note that the Lexer is actually doing a lot of error
+// checking, so can assume at this point that, while that may they not
+// be correctly spelled, we're not going to get more than one jmp per
+// line etc, or more than three parts (d=c;j) per line.  So this isn't
+// really a parser, it just maps instruction mnemonics.
+//
+// Carries on after an error, so that a full list of errors can be
+// returned.
+func (p *AsmParser) translate() {
 	var errs errorList
 
-	if p.Error != nil {
-		return
-	}
+	var i asm        // instruction, reset to 0 after every write
+	var err error    // the first error in the instruction
+	var pending bool // an instruction has been started but not written
+
+	// dest, comp and jump are ORed together for the final instruction
+	add := func(part asm, e error) {
+		i = i | part
+		pending = true
 
-	var i asm // instruction, reset to 0 after every write
-	var err error
-	var d, c, j asm // dest, comp, jump, OR together for final instruction
+		if err == nil {
+			err = e
+		}
+	}
 
 	writeResult := func() {
 		if err != nil {
 			errs = append(errs, err)
 		}
 
-		if errs == nil {
-			p.Output <- fmt.Sprintf("%.16b", i)
-		}
-
+		p.words = append(p.words, i)
 		i = 0
+		err = nil
+		pending = false
 	}
 
 	for index, lex := range p.lexemes {
@@ -86,87 +156,55 @@ func (p *AsmParser) run() {
 			fallthrough
 
 		case asmEOL:
-			prev := p.previousInstruction(index)
-
-			if prev.instruction != asmLABEL {
+			if pending {
 				writeResult()
 			}
 
 		case asmAINSTRUCT:
-			prev := p.previousInstruction(index)
-
-			if prev.instruction == asmAINSTRUCT {
-				fmt.Fprintf(os.Stderr, "WARNING - redundant loading of A-Register on line %d\n", prev.lineNum)
-			}
-
-			i, err = p.mapToA(lex)
+			add(p.mapToA(lex))
 
 		case asmLABEL:
 			index += 2 // skip label and EOL
 			continue
 
 		case asmJUMP:
-			j, err = mapJmp(lex.value)
-			i = i | j
+			add(mapJmp(lex.value))
 
 		case asmCOMP:
-			c, err = mapCmp(lex.value)
-			i = i | c
+			add(mapCmp(lex.value))
 
 		case asmDEST:
-			d, err = mapDest(lex.value)
-			i = i | d
+			add(mapDest(lex.value))
 		}
 
 		index++
 	}
 
-	p.Error = errs.asError()
-}
-
-func (p *AsmParser) previousInstruction(index int) asmLexeme {
-	nil := asmLexeme{instruction: asmNULL}
-
-	if index-2 < 0 {
-		return nil
-	}
-
-	previous := p.lexemes[index-1]
-
-	if previous.instruction == asmEOL {
-		previous = p.lexemes[index-2]
+	if len(errs) > 0 {
+		p.words = nil
 	}
 
-	return previous
+	p.Error = errs.asError()
 }
 
 func (p *AsmParser) mapToA(l asmLexeme) (asm, error) {
 	// is it a constant?
 	if c, err := strconv.Atoi(l.value); err == nil {
-		// and is it within the allowed range? (0 - 2^15)
-		if c >= 0 && c <= maxConst {
+		// and is it within the allowed range? (0 - 2^15-1, as the top
+		// bit would make it a C-instruction)
+		if c >= 0 && c < maxConst {
 			return aInst | asm(c), nil
 		}
 
 		return 0, fmt.Errorf("Constant value out of range, line %d: %s", l.lineNum, l.value)
 	}
 
-	// does the value exist in the symbol table?
-	if sym := p.symbolValue(l.value); sym != asm(0) {
-		return aInst | sym, nil
+	// labels, variables and predefined symbols are all in the table
+	if sym, ok := p.lookup(l.value); ok {
+		return aInst | sym.value, nil
 	}
 
-	// is it a register?
-	if reg, ok := registers[l.value]; ok {
-		return aInst | reg, nil
-	}
-
-	// is it a predefined pointer?
-	if ptr, ok := pointers[l.value]; ok {
-		return aInst | ptr, nil
-	}
-
-	return asm(0), fmt.Errorf("Unrecognised value for A-Instruction: %s", l.value)
+	return asm(0), fmt.Errorf("Unrecognised value for A-Instruction, line %d: %s", l.lineNum, l.value)
 }
 
 // First pass (parse?) - builds the symbol table.
@@ -175,9 +213,20 @@ func (p *AsmParser) buildSymbols() {
 	var errs errorList
 	var foundComp bool
 	var previous = asmEOL
+	var lastLoad = -1 // line of the previous lexeme if it loaded A
+	var scope = newLabelScope()
 
 	for {
-		lex, ok := <-p.items
+		var lex asmLexeme
+		var ok bool
+
+		select {
+		case lex, ok = <-p.items:
+		case <-p.ctx.Done():
+			p.Error = p.ctx.Err()
+			go drain(p.items)
+			return
+		}
 
 		if !ok {
 			break
@@ -188,25 +237,47 @@ func (p *AsmParser) buildSymbols() {
 		case asmERROR:
 			errs = append(errs, errors.New(lex.value))
 
+		// a final c-instruction may not have an EOL after it
+		case asmEOF:
+			fallthrough
+
 		case asmEOL:
 			if foundComp {
+				p.lines = append(p.lines, lex.lineNum)
 				pCount++
 				foundComp = false
 			}
 
-		// case asmEOF:
-		// 	break
-
 		case asmLABEL:
-			p.addLabel(lex.value, asm(pCount))
+			local := isLocalLabel(lex.value)
+			lex.value = scope.define(lex.value)
+
+			if err := p.addLabel(lex.value, asm(pCount), lex.lineNum, local); err != nil {
+				errs = append(errs, err)
+			}
 
 		case asmAINSTRUCT:
-			pCount++
-			if !isInt(lex.value) ||
-				!isRegister(lex.value) {
-				p.addVariable(lex.value)
+			if lastLoad >= 0 {
+				p.Warnings = append(p.Warnings, fmt.Sprintf("Redundant loading of A-Register on line %d", lastLoad))
 			}
 
+			if !isInt(lex.value) {
+				var err error
+
+				if lex.value, err = scope.resolve(lex.value, lex.lineNum); err != nil {
+					errs = append(errs, err)
+				}
+
+				p.addVariable(lex.value, lex.lineNum)
+				p.refs[pCount] = lex.value
+			}
+
+			p.lines = append(p.lines, lex.lineNum)
+			pCount++
+
+		case asmJUMP:
+			p.jumps[pCount] = lex.value
+
 		case asmDEST:
 			fallthrough
 
@@ -214,6 +285,14 @@ func (p *AsmParser) buildSymbols() {
 			foundComp = true
 		}
 
+		switch lex.instruction {
+		case asmEOL:
+		case asmAINSTRUCT:
+			lastLoad = lex.lineNum
+		default:
+			lastLoad = -1
+		}
+
 		dupeEol := lex.instruction == asmEOL && previous == asmEOL
 
 		if !dupeEol {
@@ -223,13 +302,32 @@ func (p *AsmParser) buildSymbols() {
 		previous = lex.instruction
 	}
 
+	// the lexer stops early too, so the lexemes may not be complete
+	if p.ctx.Err() != nil {
+		p.Error = p.ctx.Err()
+		return
+	}
+
+	errs = append(errs, scope.check()...)
+
+	if pCount > romSize {
+		errs = append(errs, fmt.Errorf("Program is too big for ROM, %d instructions (maximum %d)", pCount, romSize))
+	}
+
 	if len(errs) == 0 {
-		p.writeMem()
+		if err := p.writeMem(); err != nil {
+			errs = append(errs, err)
+		}
 	}
 
 	p.Error = errs.asError()
 }
 
+func drain(items chan asmLexeme) {
+	for range items {
+	}
+}
+
 func mapInstruction(i string, m map[string]asm) (asm, error) {
 	res, ok := m[i]
 
@@ -255,12 +353,46 @@ func mapCmp(c string) (asm, error) {
 func isInt(s string) bool {
 	_, err := strconv.Atoi(s)
 
-	return err != nil
+	return err == nil
+}
+
+// Usage summarises how much of ROM and RAM the program uses.
+func (p *AsmParser) Usage() string {
+	return usageSummary(len(p.lines), len(p.ofKind(symVariable)))
+}
+
+func usageSummary(instructions, variables int) string {
+	ram := fmt.Sprintf("RAM: %d variables", variables)
+
+	if variables > 0 {
+		ram += fmt.Sprintf(" at 16-%d", 15+variables)
+	}
+
+	return fmt.Sprintf("ROM: %d of %d words (%.1f%%)\n%s, %.1f%% of the %d words available before SCREEN\n",
+		instructions, romSize, float64(instructions)*100/romSize,
+		ram, float64(variables)*100/(screenBase-16), screenBase-16)
 }
 
-func isRegister(s string) bool {
-	_, r := registers[s]
-	_, p := pointers[s]
+// Assembles source in one go, returning the machine instructions
+// rather than their string representation.
+func assemble(source string) ([]asm, error) {
+	parser := NewParser(StartLexingAsm(source))
+
+	if parser.Error != nil {
+		return nil, parser.Error
+	}
+
+	var words []asm
+
+	for s := range parser.Output {
+		w, err := strconv.ParseUint(s, 2, 16)
+
+		if err != nil {
+			return nil, err
+		}
+
+		words = append(words, asm(w))
+	}
 
-	return r || p
+	return words, parser.Error
 }
@@ -1,6 +1,13 @@
 package components
 
-import "testing"
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"testing"
+)
 
 const mismatchLength = "Mismatched results (%s).  Expected %d instructions, got %d."
 const mismatchInstruction = "Mismatched instruction (%s).  Expected %s, got %s."
@@ -36,7 +43,7 @@ func Test(t *testing.T) {
 	}
 }
 
-func collectResults(p AsmParser) []string {
+func collectResults(p *AsmParser) []string {
 	var results []string
 
 	for {
@@ -84,3 +91,234 @@ func newChannel(asm []asmLexeme) chan asmLexeme {
 
 	return c
 }
+
+var sizeTests = []struct {
+	name     string
+	source   string
+	expected string
+}{
+	{"Too many instructions",
+		strings.Repeat("D=0\n", romSize+1),
+		"Program is too big for ROM, 32769 instructions (maximum 32768)"},
+	{"Too many variables",
+		variables(screenBase - 15),
+		"the start of SCREEN"},
+}
+
+// n different variables
+func variables(n int) string {
+	var b strings.Builder
+
+	for i := 0; i < n; i++ {
+		fmt.Fprintf(&b, "@v%d\n", i)
+	}
+
+	return b.String()
+}
+
+func TestSizeLimits(t *testing.T) {
+	for _, tst := range sizeTests {
+		_, err := AssembleProgram(tst.source)
+
+		if err == nil || !strings.Contains(err.Error(), tst.expected) {
+			t.Errorf("%s: expected %q, got %v", tst.name, tst.expected, err)
+		}
+	}
+
+	// right up to the limits is fine
+	for _, source := range []string{strings.Repeat("D=0\n", romSize), variables(screenBase - 16)} {
+		if _, err := AssembleProgram(source); err != nil {
+			t.Error(err)
+		}
+	}
+}
+
+func TestUsage(t *testing.T) {
+	prog, err := AssembleProgram("@5\nD=A\n@R0\nM=D\n@x\nM=D\n@y\nM=D\n")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := "ROM: 8 of 32768 words (0.0%)\nRAM: 2 variables at 16-17, 0.0% of the 16368 words available before SCREEN\n"
+
+	if usage := prog.Usage(); usage != expected {
+		t.Errorf("Expected\n%s\ngot\n%s", expected, usage)
+	}
+}
+
+func TestWarnings(t *testing.T) {
+	parser := NewParser(StartLexingAsm("@1\n@2\nD=A\n@3\n(X)\n@4\nD=A\n@5\n\n@6\nD=A"))
+
+	for range parser.Output {
+	}
+
+	expected := "Redundant loading of A-Register on line 1\nRedundant loading of A-Register on line 8"
+
+	if warnings := strings.Join(parser.Warnings, "\n"); warnings != expected {
+		t.Errorf("Expected\n%s\ngot\n%s", expected, warnings)
+	}
+}
+
+// Variables are allocated in order of first use, so the output is the
+// same every time.
+func TestPongReference(t *testing.T) {
+	source, err := ioutil.ReadFile("../Pong.asm")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected, err := ioutil.ReadFile("../Pong-Reference.hack")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for run := 0; run < 5; run++ {
+		var out bytes.Buffer
+		p := NewParser(StartLexingAsm(string(source)))
+
+		for asm := range p.Output {
+			fmt.Fprintln(&out, asm)
+		}
+
+		if !bytes.Equal(out.Bytes(), expected) {
+			var diffs bytes.Buffer
+
+			if prog, err := AssembleProgram(string(source)); err == nil {
+				if d, err := prog.CompareHack(bytes.NewReader(expected)); err == nil {
+					prog.WriteDifferences(&diffs, d)
+				}
+			}
+
+			t.Fatalf("Run %d doesn't match Pong-Reference.hack:\n%s", run+1, diffs.String())
+		}
+	}
+}
+
+func TestParserCancel(t *testing.T) {
+	source, err := ioutil.ReadFile("../Pong.asm")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// part way through the output, which just stops
+	checkGoroutines(t, func() {
+		ctx, cancel := context.WithCancel(context.Background())
+		p := NewParserContext(ctx, StartLexingAsmContext(ctx, string(source)))
+
+		<-p.Output
+		cancel()
+
+		read := 1
+
+		for range p.Output {
+			read++
+		}
+
+		if p.Error != context.Canceled || read >= len(p.words) {
+			t.Errorf("Expected Output to stop early as cancelled, read %d of %d (%v)", read, len(p.words), p.Error)
+		}
+	})
+
+	// a reader that just stops, and closes the parser
+	checkGoroutines(t, func() {
+		p := NewParser(StartLexingAsm(string(source)))
+
+		<-p.Output
+		p.Close()
+	})
+
+	// closing part way through isn't mistaken for the whole program
+	checkGoroutines(t, func() {
+		p := NewParser(StartLexingAsm(string(source)))
+
+		for i := 0; i < 10; i++ {
+			<-p.Output
+		}
+
+		p.Close()
+
+		for range p.Output {
+		}
+
+		if p.Error != context.Canceled {
+			t.Errorf("Expected the closed parser's Error to be context.Canceled, got %v", p.Error)
+		}
+	})
+
+	// closing once it's finished changes nothing
+	checkGoroutines(t, func() {
+		p := NewParserContext(context.Background(), StartLexingAsm("@1\nD=A"))
+
+		for range p.Output {
+		}
+
+		p.Close()
+
+		if p.Error != nil {
+			t.Errorf("Expected no error, got %v", p.Error)
+		}
+	})
+
+	// before it's started, with a lexer that isn't cancelled
+	checkGoroutines(t, func() {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		p := NewParserContext(ctx, StartLexingAsm(string(source)))
+
+		if _, open := <-p.Output; open || p.Error != context.Canceled {
+			t.Errorf("Expected the parser to be cancelled with Output closed, got %v", p.Error)
+		}
+	})
+}
+
+func TestParserPanic(t *testing.T) {
+	checkGoroutines(t, func() {
+		l := newLexer(context.Background(), "@1\nD=A")
+		l.Run(func(l *lexer) stateFunction { panic("Oops") })
+
+		p := NewParser(l.output)
+
+		if p.Error == nil || p.Error.Error() != "Lexer panic, line 1: Oops" {
+			t.Errorf("Expected the lexer's panic as an error, got %v", p.Error)
+		}
+
+		if _, open := <-p.Output; open {
+			t.Error("Expected Output to be closed")
+		}
+	})
+}
+
+// Constants don't take variable slots, and a trailing newline (or a
+// label followed by blank lines) doesn't add an empty instruction or
+// drop the next one.
+var assembled = []struct {
+	name     string
+	source   string
+	expected []asm
+}{
+	{"Constant before a variable",
+		"@5\nD=A\n@x\nM=D\n",
+		[]asm{5, 0xec10, 16, 0xe308}},
+	{"Labels then blank lines",
+		"\n\n(A)\n(B)\n\n@B\n0;JMP\n",
+		[]asm{0, 0xea87}},
+}
+
+func TestAssembled(t *testing.T) {
+	for _, tst := range assembled {
+		prog, err := AssembleProgram(tst.source)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if fmt.Sprint(prog.words) != fmt.Sprint(tst.expected) {
+			t.Errorf("%s: expected %v, got %v", tst.name, tst.expected, prog.words)
+		}
+	}
+}
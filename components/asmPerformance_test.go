@@ -9,7 +9,7 @@ import (
 	"testing"
 )
 
-const inputAsm string = "../assembler/Pong.asm"
+const inputAsm string = "../Pong.asm"
 
 // BenchmarkPong does benchmarking.
 // Oh god linting errors are well meaning pain....
@@ -0,0 +1,98 @@
+package components
+
+import (
+	"strconv"
+	"strings"
+)
+
+// Program is an assembled program along with what's needed to map it
+// back to its source; which line each instruction came from, and
+// where the labels and variables ended up.
+type Program struct {
+	Source    []string       // the source, Source[0] being line 1
+	Lines     []int          // source line number of each instruction
+	Labels    map[string]int // ROM address of each label
+	Variables map[string]int // RAM address of each variable
+	words     []asm
+	jumps     map[int]string // jump mnemonic of each C-instruction that has one
+}
+
+// AssembleProgram assembles source, keeping hold of the source map
+// and symbols.
+func AssembleProgram(source string) (*Program, error) {
+	parser := NewParser(StartLexingAsm(source))
+
+	if parser.Error != nil {
+		return nil, parser.Error
+	}
+
+	prog := Program{
+		Source:    strings.Split(strings.Replace(source, "\r\n", "\n", -1), "\n"),
+		Lines:     parser.lines,
+		Labels:    parser.ofKind(symLabel),
+		Variables: parser.ofKind(symVariable),
+		jumps:     parser.jumps,
+	}
+
+	for s := range parser.Output {
+		w, err := strconv.ParseUint(s, 2, 16)
+
+		if err != nil {
+			return nil, err
+		}
+
+		prog.words = append(prog.words, asm(w))
+	}
+
+	if parser.Error != nil {
+		return nil, parser.Error
+	}
+
+	return &prog, nil
+}
+
+// Size is the number of instructions in the program.
+func (p *Program) Size() int {
+	return len(p.words)
+}
+
+// Usage summarises how much of ROM and RAM the program uses.
+func (p *Program) Usage() string {
+	return usageSummary(p.Size(), len(p.Variables))
+}
+
+// SourceLine returns the line number and text of the source that
+// produced the instruction at addr.
+func (p *Program) SourceLine(addr int) (int, string, bool) {
+	if addr < 0 || addr >= len(p.Lines) {
+		return 0, "", false
+	}
+
+	n := p.Lines[addr]
+
+	if n < 1 || n > len(p.Source) {
+		return 0, "", false
+	}
+
+	return n, strings.TrimSpace(p.Source[n-1]), true
+}
+
+// LabelAt returns the name of a label at addr, if there is one.
+// Where there's more than one the first alphabetically is used, so
+// that it's at least consistent.
+func (p *Program) LabelAt(addr int) (string, bool) {
+	found := ""
+
+	for name, a := range p.Labels {
+		if a == addr && (found == "" || name < found) {
+			found = name
+		}
+	}
+
+	return found, found != ""
+}
+
+// LoadProgram loads an assembled program into ROM.
+func (c *HackComputer) LoadProgram(p *Program) {
+	c.loadWords(p.words)
+}
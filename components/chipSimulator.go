@@ -0,0 +1,747 @@
+/*
+ Gate level simulator for chips described in HDL.  A chip is flattened
+ all the way down to its Nand gates and DFFs, with each bit of every
+ pin being a 'wire'.  The gates are then sorted so that evaluating them
+ in order settles the combinational logic in a single pass, with the
+ DFFs (and the chip's inputs) being the only sources of state.
+*/
+
+package components
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// RunChipScript runs a test script against the chip simulator.  The
+// chip named in the script's load command, and any chips it uses, are
+// read from the script's directory.
+func RunChipScript(path string) error {
+	return runTestScript(path, &chipTarget{})
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// Netlist
+////////////////////////////////////////////////////////////////////////////////
+
+type gateKind uint8
+
+const (
+	gateNand   gateKind = iota // out = !(a & b)
+	gateBuffer                 // out = a, joins a part's output to a pin
+)
+
+type gate struct {
+	kind gateKind
+	a    int
+	b    int
+	out  int
+}
+
+type dff struct {
+	in   int
+	out  int
+	next bool // value latched on the tick, output on the tock
+}
+
+// Wires 0 and 1 are the constants false and true.
+const wireFalse = 0
+const wireTrue = 1
+
+type netlist struct {
+	wires  []bool
+	gates  []gate
+	dffs   []dff
+	driven map[int]bool // wires with something writing to them
+}
+
+func newNetlist() *netlist {
+	return &netlist{
+		wires:  []bool{false, true},
+		driven: map[int]bool{wireFalse: true, wireTrue: true},
+	}
+}
+
+func (n *netlist) newWires(count int) []int {
+	w := make([]int, count)
+
+	for i := range w {
+		w[i] = len(n.wires)
+		n.wires = append(n.wires, false)
+	}
+
+	return w
+}
+
+// Wires all set to the same constant.
+func constantWires(count int, value int) []int {
+	w := make([]int, count)
+
+	for i := range w {
+		w[i] = value
+	}
+
+	return w
+}
+
+func (n *netlist) drive(out int) error {
+	if n.driven[out] {
+		return errors.New("pin is driven by more than one part")
+	}
+
+	n.driven[out] = true
+
+	return nil
+}
+
+// Sorts gates so that each is evaluated after anything driving its
+// inputs.  Anything left over is part of a loop that doesn't go
+// through a DFF.
+func (n *netlist) sort() error {
+	driver := make(map[int]int, len(n.gates))
+	users := make(map[int][]int)
+
+	for i, g := range n.gates {
+		driver[g.out] = i
+	}
+
+	waiting := make([]int, len(n.gates))
+	var ready []int
+
+	for i, g := range n.gates {
+		inputs := []int{g.a}
+
+		if g.kind == gateNand {
+			inputs = append(inputs, g.b)
+		}
+
+		for _, in := range inputs {
+			if d, ok := driver[in]; ok {
+				users[d] = append(users[d], i)
+				waiting[i]++
+			}
+		}
+
+		if waiting[i] == 0 {
+			ready = append(ready, i)
+		}
+	}
+
+	sorted := make([]gate, 0, len(n.gates))
+
+	for len(ready) > 0 {
+		i := ready[len(ready)-1]
+		ready = ready[:len(ready)-1]
+		sorted = append(sorted, n.gates[i])
+
+		for _, u := range users[i] {
+			waiting[u]--
+
+			if waiting[u] == 0 {
+				ready = append(ready, u)
+			}
+		}
+	}
+
+	if len(sorted) != len(n.gates) {
+		return errors.New("Combinational loop; every feedback loop must pass through a DFF")
+	}
+
+	n.gates = sorted
+
+	return nil
+}
+
+// Settles the combinational logic.
+func (n *netlist) eval() {
+	w := n.wires
+
+	for _, g := range n.gates {
+		if g.kind == gateNand {
+			w[g.out] = !(w[g.a] && w[g.b])
+		} else {
+			w[g.out] = w[g.a]
+		}
+	}
+}
+
+// Rising edge of the clock, DFFs latch their inputs.
+func (n *netlist) tick() {
+	n.eval()
+
+	for i := range n.dffs {
+		n.dffs[i].next = n.wires[n.dffs[i].in]
+	}
+}
+
+// Falling edge, DFFs output what they latched.
+func (n *netlist) tock() {
+	for _, d := range n.dffs {
+		n.wires[d.out] = d.next
+	}
+
+	n.eval()
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// Flattening chips into the netlist.
+////////////////////////////////////////////////////////////////////////////////
+
+// Chips implemented by the simulator rather than in HDL.
+var builtinChips = map[string]*hdlChip{
+	"Nand": {
+		name:    "Nand",
+		inputs:  []hdlPin{{"a", 1}, {"b", 1}},
+		outputs: []hdlPin{{"out", 1}},
+		builtin: "Nand",
+	},
+	"DFF": {
+		name:    "DFF",
+		inputs:  []hdlPin{{"in", 1}},
+		outputs: []hdlPin{{"out", 1}},
+		builtin: "DFF",
+		clocked: []string{"in"},
+	},
+}
+
+type chipBuilder struct {
+	dir      string
+	chips    map[string]*hdlChip
+	building map[string]bool // chips part way through being built, to catch recursion
+	net      *netlist
+}
+
+func newChipBuilder(dir string) *chipBuilder {
+	return &chipBuilder{
+		dir:      dir,
+		chips:    make(map[string]*hdlChip),
+		building: make(map[string]bool),
+		net:      newNetlist(),
+	}
+}
+
+// Looks for name.hdl in the chip directory first, and falls back to
+// the built-in chips.
+func (b *chipBuilder) definition(name string) (*hdlChip, error) {
+	if chip, ok := b.chips[name]; ok {
+		return chip, nil
+	}
+
+	path := filepath.Join(b.dir, name+".hdl")
+	src, err := ioutil.ReadFile(path)
+
+	if os.IsNotExist(err) {
+		if chip, ok := builtinChips[name]; ok {
+			b.chips[name] = chip
+			return chip, nil
+		}
+
+		return nil, fmt.Errorf("Cannot find chip %s", name)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	chip, err := parseHdl(string(src))
+
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", path, err)
+	}
+
+	if chip.name != name {
+		return nil, fmt.Errorf("%s: defines chip %s, expected %s", path, chip.name, name)
+	}
+
+	if chip.builtin != "" {
+		builtin, ok := builtinChips[chip.builtin]
+
+		if !ok {
+			return nil, fmt.Errorf("%s: no built-in implementation of %s", path, chip.builtin)
+		}
+
+		chip = builtin
+	}
+
+	b.chips[name] = chip
+
+	return chip, nil
+}
+
+// Adds an instance of the named chip to the netlist, with its inputs
+// connected to the given wires, returning the wires of its outputs.
+func (b *chipBuilder) instantiate(name string, inputs map[string][]int) (map[string][]int, error) {
+	chip, err := b.definition(name)
+
+	if err != nil {
+		return nil, err
+	}
+
+	switch chip.builtin {
+	case "Nand":
+		out := b.net.newWires(1)
+		b.net.gates = append(b.net.gates, gate{gateNand, inputs["a"][0], inputs["b"][0], out[0]})
+		b.net.driven[out[0]] = true
+		return map[string][]int{"out": out}, nil
+
+	case "DFF":
+		out := b.net.newWires(1)
+		b.net.dffs = append(b.net.dffs, dff{in: inputs["in"][0], out: out[0]})
+		b.net.driven[out[0]] = true
+		return map[string][]int{"out": out}, nil
+	}
+
+	if b.building[name] {
+		return nil, fmt.Errorf("Chip %s uses itself as a part", name)
+	}
+
+	b.building[name] = true
+	defer delete(b.building, name)
+
+	inst := chipInstance{chip: chip, pins: make(map[string][]int), internal: make(map[string]bool)}
+
+	for _, in := range chip.inputs {
+		inst.pins[in.name] = inputs[in.name]
+	}
+
+	for _, out := range chip.outputs {
+		inst.pins[out.name] = b.net.newWires(out.width)
+	}
+
+	if err := b.internalPins(&inst); err != nil {
+		return nil, fmt.Errorf("%s: %s", name, err)
+	}
+
+	for _, part := range chip.parts {
+		if err := b.connectPart(&inst, part); err != nil {
+			return nil, fmt.Errorf("%s: %s", name, err)
+		}
+	}
+
+	outputs := make(map[string][]int)
+
+	for _, out := range chip.outputs {
+		outputs[out.name] = inst.pins[out.name]
+	}
+
+	return outputs, nil
+}
+
+type chipInstance struct {
+	chip     *hdlChip
+	pins     map[string][]int
+	internal map[string]bool
+}
+
+// Internal pins take their width from whichever part output drives
+// them, so allocate them all up front to allow them to be used before
+// the part that drives them.
+func (b *chipBuilder) internalPins(inst *chipInstance) error {
+	for _, part := range inst.chip.parts {
+		def, err := b.definition(part.chip)
+
+		if err != nil {
+			return err
+		}
+
+		for _, c := range part.connections {
+			pin, isOutput := def.output(c.inner.name)
+
+			if !isOutput || inst.pins[c.outer.name] != nil || isConstant(c.outer.name) {
+				continue
+			}
+
+			if _, isInput := inst.chip.input(c.outer.name); isInput {
+				continue
+			}
+
+			if c.outer.subBus {
+				return fmt.Errorf("Sub bus of internal pin %s, line %d", c.outer, c.outer.lineNum)
+			}
+
+			width := pin.width
+
+			if c.inner.subBus {
+				width = c.inner.high - c.inner.low + 1
+			}
+
+			inst.pins[c.outer.name] = b.net.newWires(width)
+			inst.internal[c.outer.name] = true
+		}
+	}
+
+	return nil
+}
+
+func (b *chipBuilder) connectPart(inst *chipInstance, part hdlPart) error {
+	def, err := b.definition(part.chip)
+
+	if err != nil {
+		return err
+	}
+
+	// unconnected inputs default to false
+	inputs := make(map[string][]int)
+
+	for _, in := range def.inputs {
+		inputs[in.name] = constantWires(in.width, wireFalse)
+	}
+
+	for _, c := range part.connections {
+		pin, ok := def.input(c.inner.name)
+
+		if !ok {
+			continue
+		}
+
+		inner, err := subBus(c.inner, inputs[pin.name])
+
+		if err != nil {
+			return err
+		}
+
+		outer, err := inst.source(c.outer, len(inner))
+
+		if err != nil {
+			return err
+		}
+
+		if len(inner) != len(outer) {
+			return widthMismatch(c, len(inner), len(outer))
+		}
+
+		copy(inner, outer)
+	}
+
+	outputs, err := b.instantiate(part.chip, inputs)
+
+	if err != nil {
+		return err
+	}
+
+	for _, c := range part.connections {
+		if _, ok := def.input(c.inner.name); ok {
+			continue
+		}
+
+		if _, ok := def.output(c.inner.name); !ok {
+			return fmt.Errorf("%s has no pin named %s, line %d", part.chip, c.inner.name, c.inner.lineNum)
+		}
+
+		inner, err := subBus(c.inner, outputs[c.inner.name])
+
+		if err != nil {
+			return err
+		}
+
+		outer, err := inst.sink(c.outer)
+
+		if err != nil {
+			return err
+		}
+
+		if len(inner) != len(outer) {
+			return widthMismatch(c, len(inner), len(outer))
+		}
+
+		for i := range outer {
+			if err := b.net.drive(outer[i]); err != nil {
+				return fmt.Errorf("%s %s, line %d", c.outer, err, c.outer.lineNum)
+			}
+
+			b.net.gates = append(b.net.gates, gate{kind: gateBuffer, a: inner[i], out: outer[i]})
+		}
+	}
+
+	return nil
+}
+
+// Wires feeding a part's input; one of the chip's pins, or true/false
+// spread across the width of the input.
+func (inst *chipInstance) source(ref hdlPinRef, width int) ([]int, error) {
+	switch ref.name {
+	case "true":
+		return constantWires(width, wireTrue), nil
+	case "false":
+		return constantWires(width, wireFalse), nil
+	}
+
+	wires, ok := inst.pins[ref.name]
+
+	if !ok {
+		return nil, fmt.Errorf("Unknown pin %s, line %d", ref.name, ref.lineNum)
+	}
+
+	if ref.subBus && inst.internal[ref.name] {
+		return nil, fmt.Errorf("Sub bus of internal pin %s, line %d", ref, ref.lineNum)
+	}
+
+	return subBus(ref, wires)
+}
+
+// Wires a part's output can drive; the chip's outputs or internal
+// pins.
+func (inst *chipInstance) sink(ref hdlPinRef) ([]int, error) {
+	if isConstant(ref.name) {
+		return nil, fmt.Errorf("Cannot drive %s, line %d", ref.name, ref.lineNum)
+	}
+
+	if _, ok := inst.chip.input(ref.name); ok {
+		return nil, fmt.Errorf("Cannot drive input pin %s, line %d", ref.name, ref.lineNum)
+	}
+
+	return subBus(ref, inst.pins[ref.name])
+}
+
+func subBus(ref hdlPinRef, wires []int) ([]int, error) {
+	if !ref.subBus {
+		return wires, nil
+	}
+
+	if ref.high >= len(wires) {
+		return nil, fmt.Errorf("Sub bus %s out of range, line %d", ref, ref.lineNum)
+	}
+
+	return wires[ref.low : ref.high+1], nil
+}
+
+func isConstant(name string) bool {
+	return name == "true" || name == "false"
+}
+
+func widthMismatch(c hdlConnection, inner, outer int) error {
+	return fmt.Errorf("Width mismatch connecting %s (%d) to %s (%d), line %d",
+		c.inner, inner, c.outer, outer, c.inner.lineNum)
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// Simulator
+////////////////////////////////////////////////////////////////////////////////
+
+// Chip is a simulated instance of an HDL chip.
+type Chip struct {
+	name    string
+	net     *netlist
+	inputs  map[string][]int
+	outputs map[string][]int
+}
+
+// LoadChip builds the chip defined in an .hdl file, looking for the
+// chips it uses in the same directory.
+func LoadChip(path string) (*Chip, error) {
+	dir := filepath.Dir(path)
+	name := strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+	b := newChipBuilder(dir)
+
+	def, err := b.definition(name)
+
+	if err != nil {
+		return nil, err
+	}
+
+	inputs := make(map[string][]int)
+
+	for _, in := range def.inputs {
+		inputs[in.name] = b.net.newWires(in.width)
+	}
+
+	outputs, err := b.instantiate(name, inputs)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if err := b.net.sort(); err != nil {
+		return nil, fmt.Errorf("%s: %s", name, err)
+	}
+
+	chip := &Chip{
+		name:    name,
+		net:     b.net,
+		inputs:  inputs,
+		outputs: outputs,
+	}
+
+	chip.net.eval()
+
+	return chip, nil
+}
+
+// Eval settles the combinational logic after inputs have changed.
+func (c *Chip) Eval() {
+	c.net.eval()
+}
+
+// Tick is the rising edge of the clock.
+func (c *Chip) Tick() {
+	c.net.tick()
+}
+
+// Tock is the falling edge of the clock.
+func (c *Chip) Tock() {
+	c.net.tock()
+}
+
+// Get returns the value of an input or output pin, which may be sub
+// bussed (e.g. out[3]).  16 bit values are treated as signed.
+func (c *Chip) Get(pin string) (int, error) {
+	wires, err := c.pin(pin)
+
+	if err != nil {
+		return 0, err
+	}
+
+	v := 0
+
+	for i, w := range wires {
+		if c.net.wires[w] {
+			v |= 1 << uint(i)
+		}
+	}
+
+	if len(wires) == 16 {
+		v = int(int16(v))
+	}
+
+	return v, nil
+}
+
+// Set sets the value of an input pin, which may be sub bussed.
+func (c *Chip) Set(pin string, value int) error {
+	name := strings.SplitN(pin, "[", 2)[0]
+
+	if _, ok := c.inputs[name]; !ok {
+		return fmt.Errorf("%s is not an input pin of %s", name, c.name)
+	}
+
+	wires, err := c.pin(pin)
+
+	if err != nil {
+		return err
+	}
+
+	for i, w := range wires {
+		c.net.wires[w] = value&(1<<uint(i)) != 0
+	}
+
+	return nil
+}
+
+// Finds the wires for name, name[i] or name[i..j].
+func (c *Chip) pin(pin string) ([]int, error) {
+	ref := hdlPinRef{name: pin}
+
+	if open := strings.Index(pin, "["); open != -1 {
+		if !strings.HasSuffix(pin, "]") {
+			return nil, fmt.Errorf("Invalid pin: %s", pin)
+		}
+
+		ref.name = pin[:open]
+		ref.subBus = true
+		bounds := strings.SplitN(pin[open+1:len(pin)-1], "..", 2)
+		var err error
+
+		if ref.low, err = strconv.Atoi(bounds[0]); err != nil {
+			return nil, fmt.Errorf("Invalid pin: %s", pin)
+		}
+
+		ref.high = ref.low
+
+		if len(bounds) == 2 {
+			if ref.high, err = strconv.Atoi(bounds[1]); err != nil || ref.high < ref.low {
+				return nil, fmt.Errorf("Invalid pin: %s", pin)
+			}
+		}
+	}
+
+	wires, ok := c.inputs[ref.name]
+
+	if !ok {
+		wires, ok = c.outputs[ref.name]
+	}
+
+	if !ok {
+		return nil, fmt.Errorf("%s has no pin named %s", c.name, ref.name)
+	}
+
+	return subBus(ref, wires)
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// The chip simulator as a script target.
+////////////////////////////////////////////////////////////////////////////////
+
+type chipTarget struct {
+	chip *Chip
+}
+
+func (t *chipTarget) load(name string) error {
+	chip, err := LoadChip(name)
+
+	if err != nil {
+		return err
+	}
+
+	t.chip = chip
+
+	return nil
+}
+
+func (t *chipTarget) loaded() error {
+	if t.chip == nil {
+		return errors.New("No chip loaded")
+	}
+
+	return nil
+}
+
+func (t *chipTarget) get(variable string) (int, error) {
+	if err := t.loaded(); err != nil {
+		return 0, err
+	}
+
+	return t.chip.Get(variable)
+}
+
+func (t *chipTarget) set(variable string, value int) error {
+	if err := t.loaded(); err != nil {
+		return err
+	}
+
+	return t.chip.Set(variable, value)
+}
+
+func (t *chipTarget) eval() error {
+	if err := t.loaded(); err != nil {
+		return err
+	}
+
+	t.chip.Eval()
+
+	return nil
+}
+
+func (t *chipTarget) tick() error {
+	if err := t.loaded(); err != nil {
+		return err
+	}
+
+	t.chip.Tick()
+
+	return nil
+}
+
+func (t *chipTarget) tock() error {
+	if err := t.loaded(); err != nil {
+		return err
+	}
+
+	t.chip.Tock()
+
+	return nil
+}
@@ -0,0 +1,79 @@
+package components
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestChipScripts(t *testing.T) {
+	for _, script := range []string{"And.tst", "Bit.tst"} {
+		if err := RunChipScript("testdata/chips/" + script); err != nil {
+			t.Errorf("%s: %s", script, err)
+		}
+	}
+}
+
+func TestSubBuses(t *testing.T) {
+	chip, err := LoadChip("testdata/chips/Swap4.hdl")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// in = 0001, swapped 0100, inverted 1011
+	chip.Set("in", 1)
+	chip.Eval()
+
+	if out, _ := chip.Get("out"); out != 11 {
+		t.Errorf("Expected out of 11, got %d", out)
+	}
+
+	if top, _ := chip.Get("top"); top != 2 {
+		t.Errorf("Expected top of 2, got %d", top)
+	}
+
+	if bit, _ := chip.Get("out[1]"); bit != 1 {
+		t.Errorf("Expected out[1] of 1, got %d", bit)
+	}
+}
+
+var badChips = []struct {
+	name     string
+	hdl      string
+	expected string
+}{
+	{"Missing semicolon", "CHIP X { IN a OUT b; PARTS: }", "Expected ',' or ';'"},
+	{"Unknown part", "CHIP X { IN a; OUT b; PARTS: Nope(in=a, out=b); }", "Cannot find chip Nope"},
+	{"Unknown pin", "CHIP X { IN a; OUT b; PARTS: Not(in=c, out=b); }", "Unknown pin c"},
+	{"Bad part pin", "CHIP X { IN a; OUT b; PARTS: Not(in=a, oot=b); }", "Not has no pin named oot"},
+	{"Driving an input", "CHIP X { IN a; OUT b; PARTS: Not(in=a, out=a); }", "Cannot drive input pin a"},
+	{"Width mismatch", "CHIP X { IN a[2]; OUT b; PARTS: Not(in=a, out=b); }", "Width mismatch"},
+	{"Two drivers", "CHIP X { IN a; OUT b; PARTS: Not(in=a, out=b); Not(in=a, out=b); }", "more than one part"},
+	{"Internal sub bus", "CHIP X { IN a; OUT b; PARTS: Not(in=a, out=x[0]); }", "Sub bus of internal pin"},
+}
+
+func TestChipErrors(t *testing.T) {
+	for _, tst := range badChips {
+		def, err := parseHdl(tst.hdl)
+
+		if err == nil {
+			b := newChipBuilder("testdata/chips")
+			b.chips["X"] = def
+			inputs := map[string][]int{}
+
+			for _, in := range def.inputs {
+				inputs[in.name] = b.net.newWires(in.width)
+			}
+
+			_, err = b.instantiate("X", inputs)
+		}
+
+		if err == nil || !strings.Contains(err.Error(), tst.expected) {
+			t.Errorf("%s: expected an error containing %q, got %v", tst.name, tst.expected, err)
+		}
+	}
+
+	if _, err := LoadChip("testdata/chips/Loop.hdl"); err == nil || !strings.Contains(err.Error(), "Combinational loop") {
+		t.Errorf("Expected a combinational loop error, got %v", err)
+	}
+}
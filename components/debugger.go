@@ -0,0 +1,398 @@
+/*
+ A command driven debugger for the emulator.  It knows nothing about
+ terminals, it just takes a line at a time and writes its results to
+ out, so that the CLI (or a test) can drive it.
+*/
+
+package components
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Debugger controls a HackComputer, optionally with the Program that
+// was loaded into it so that labels, variables and source lines can
+// be used.
+type Debugger struct {
+	computer    *HackComputer
+	program     *Program // nil if all we have is machine code
+	out         io.Writer
+	breakpoints map[int]bool
+	watchpoints map[int]int16 // RAM address to last seen value
+	lastCommand string
+	MaxCycles   int // continue and next give up after this many cycles
+}
+
+const debuggerHelp = `Commands:
+  break <addr|label>     set a breakpoint (b)
+  delete <addr|label>    remove a breakpoint
+  watch <addr|variable>  stop when a RAM location changes (w)
+  unwatch <addr|variable>
+  step [n]               execute n instructions (s)
+  next                   run until the instruction after this one (n)
+  continue               run until a breakpoint, watchpoint or halt (c)
+  regs                   show the registers (r)
+  mem <addr|variable> [n]
+                         show n words of RAM (x)
+  list [addr|label]      disassemble around PC, or addr (l)
+  reset                  set PC back to 0
+  quit                   (q)
+An empty line repeats the last command.
+`
+
+// NewDebugger returns a debugger for c, which should already have
+// prog loaded.  prog may be nil.
+func NewDebugger(c *HackComputer, prog *Program, out io.Writer) *Debugger {
+	return &Debugger{
+		computer:    c,
+		program:     prog,
+		out:         out,
+		breakpoints: make(map[int]bool),
+		watchpoints: make(map[int]int16),
+		MaxCycles:   100000000,
+	}
+}
+
+// Command executes a single command, returning true if it was quit.
+func (d *Debugger) Command(line string) (bool, error) {
+	if strings.TrimSpace(line) == "" {
+		line = d.lastCommand
+	}
+
+	d.lastCommand = line
+	words := strings.Fields(line)
+
+	if len(words) == 0 {
+		return false, nil
+	}
+
+	args := words[1:]
+
+	switch words[0] {
+	case "break", "b":
+		return false, d.setBreakpoint(args, true)
+
+	case "delete":
+		return false, d.setBreakpoint(args, false)
+
+	case "watch", "w":
+		return false, d.setWatchpoint(args, true)
+
+	case "unwatch":
+		return false, d.setWatchpoint(args, false)
+
+	case "step", "s":
+		n := 1
+
+		if len(args) > 0 {
+			var err error
+			if n, err = strconv.Atoi(args[0]); err != nil || n < 1 {
+				return false, fmt.Errorf("Invalid step count: %s", args[0])
+			}
+		}
+
+		d.run(n, nil)
+
+	case "next", "n":
+		after := uint16(d.computer.PC+1) % romSize
+		d.run(d.MaxCycles, func() bool { return d.computer.PC == after })
+
+	case "continue", "c":
+		d.run(d.MaxCycles, nil)
+
+	case "regs", "r":
+		d.showRegisters()
+
+	case "mem", "x":
+		return false, d.showMemory(args)
+
+	case "list", "l":
+		return false, d.list(args)
+
+	case "reset":
+		d.computer.Reset()
+		d.where()
+
+	case "help", "h", "?":
+		fmt.Fprint(d.out, debuggerHelp)
+
+	case "quit", "q":
+		return true, nil
+
+	default:
+		return false, fmt.Errorf("Unrecognised command: %s (try help)", words[0])
+	}
+
+	return false, nil
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// Running
+////////////////////////////////////////////////////////////////////////////////
+
+// Runs up to n instructions, stopping early at a breakpoint, a changed
+// watchpoint, when the program halts or when until returns true.
+func (d *Debugger) run(n int, until func() bool) {
+	c := d.computer
+
+	for i := 0; i < n; i++ {
+		if c.Halted() {
+			fmt.Fprintf(d.out, "Program halted after %d cycles.\n", c.Time)
+			break
+		}
+
+		c.Step()
+
+		if d.watchpointHit() || (until != nil && until()) {
+			break
+		}
+
+		if d.breakpoints[int(c.PC)] {
+			fmt.Fprintf(d.out, "Breakpoint at %s\n", d.romName(int(c.PC)))
+			break
+		}
+
+		if i == n-1 && n == d.MaxCycles {
+			fmt.Fprintf(d.out, "Gave up after %d cycles.\n", n)
+		}
+	}
+
+	d.where()
+}
+
+// Reports (and records) any watched locations that have changed.
+func (d *Debugger) watchpointHit() bool {
+	hit := false
+
+	for addr, last := range d.watchpoints {
+		now := d.computer.RAM[addr]
+
+		if now != last {
+			fmt.Fprintf(d.out, "Watchpoint %s: %d -> %d\n", d.ramName(addr), last, now)
+			d.watchpoints[addr] = now
+			hit = true
+		}
+	}
+
+	return hit
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// Break and watch points
+////////////////////////////////////////////////////////////////////////////////
+
+func (d *Debugger) setBreakpoint(args []string, set bool) error {
+	if len(args) != 1 {
+		return errors.New("Expected a ROM address or label")
+	}
+
+	addr, err := d.romAddress(args[0])
+
+	if err != nil {
+		return err
+	}
+
+	if set {
+		d.breakpoints[addr] = true
+		fmt.Fprintf(d.out, "Breakpoint set at %s\n", d.romName(addr))
+	} else {
+		delete(d.breakpoints, addr)
+	}
+
+	return nil
+}
+
+func (d *Debugger) setWatchpoint(args []string, set bool) error {
+	if len(args) != 1 {
+		return errors.New("Expected a RAM address or variable")
+	}
+
+	addr, err := d.ramAddress(args[0])
+
+	if err != nil {
+		return err
+	}
+
+	if set {
+		d.watchpoints[addr] = d.computer.RAM[addr]
+		fmt.Fprintf(d.out, "Watching %s\n", d.ramName(addr))
+	} else {
+		delete(d.watchpoints, addr)
+	}
+
+	return nil
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// Display
+////////////////////////////////////////////////////////////////////////////////
+
+func (d *Debugger) showRegisters() {
+	c := d.computer
+	m := c.RAM[uint16(c.A)%ramSize]
+
+	fmt.Fprintf(d.out, "A=%d D=%d M=%d PC=%d time=%d\n", c.A, c.D, m, c.PC, c.Time)
+}
+
+func (d *Debugger) showMemory(args []string) error {
+	if len(args) < 1 || len(args) > 2 {
+		return errors.New("Expected a RAM address or variable, and optionally a count")
+	}
+
+	addr, err := d.ramAddress(args[0])
+
+	if err != nil {
+		return err
+	}
+
+	count := 1
+
+	if len(args) == 2 {
+		if count, err = strconv.Atoi(args[1]); err != nil || count < 1 {
+			return fmt.Errorf("Invalid count: %s", args[1])
+		}
+	}
+
+	for a := addr; a < addr+count && a < ramSize; a++ {
+		fmt.Fprintf(d.out, "%-20s %6d  %.16b\n", d.ramName(a), d.computer.RAM[a], uint16(d.computer.RAM[a]))
+	}
+
+	return nil
+}
+
+// Disassembly of the five instructions either side of PC (or addr).
+func (d *Debugger) list(args []string) error {
+	centre := int(d.computer.PC)
+
+	if len(args) > 0 {
+		var err error
+		if centre, err = d.romAddress(args[0]); err != nil {
+			return err
+		}
+	}
+
+	for a := max(0, centre-5); a <= min(romSize-1, centre+5); a++ {
+		if d.program != nil {
+			if label, ok := d.program.LabelAt(a); ok {
+				fmt.Fprintf(d.out, "(%s)\n", label)
+			}
+		}
+
+		fmt.Fprintln(d.out, d.describe(a))
+	}
+
+	return nil
+}
+
+// Prints the instruction about to be executed.
+func (d *Debugger) where() {
+	fmt.Fprintln(d.out, d.describe(int(d.computer.PC)))
+}
+
+// A line of disassembly, e.g.
+//
+//	=>*  12  D=M                  // 14: D=M
+//
+// where => marks the PC and * a breakpoint.
+func (d *Debugger) describe(addr int) string {
+	marker := "   "
+
+	if addr == int(d.computer.PC) {
+		marker = "=> "
+	}
+
+	if d.breakpoints[addr] {
+		marker = marker[:2] + "*"
+	}
+
+	line := fmt.Sprintf("%s%5d  %-20s", marker, addr, disassemble(d.computer.ROM[addr]))
+
+	if d.program != nil {
+		if n, src, ok := d.program.SourceLine(addr); ok {
+			line += fmt.Sprintf(" // %d: %s", n, src)
+		}
+	}
+
+	return strings.TrimRight(line, " ")
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// Names and addresses
+////////////////////////////////////////////////////////////////////////////////
+
+func (d *Debugger) romAddress(s string) (int, error) {
+	if n, err := strconv.Atoi(s); err == nil {
+		if n < 0 || n >= romSize {
+			return 0, fmt.Errorf("ROM address out of range: %s", s)
+		}
+		return n, nil
+	}
+
+	if d.program != nil {
+		if a, ok := d.program.Labels[s]; ok {
+			return a, nil
+		}
+	}
+
+	return 0, fmt.Errorf("Unknown label: %s", s)
+}
+
+func (d *Debugger) ramAddress(s string) (int, error) {
+	if n, err := strconv.Atoi(s); err == nil {
+		if n < 0 || n >= ramSize {
+			return 0, fmt.Errorf("RAM address out of range: %s", s)
+		}
+		return n, nil
+	}
+
+	if d.program != nil {
+		if a, ok := d.program.Variables[s]; ok {
+			return a, nil
+		}
+	}
+
+	if sym, ok := predefinedSymbols.lookup(s); ok {
+		return int(sym.value), nil
+	}
+
+	return 0, fmt.Errorf("Unknown variable: %s", s)
+}
+
+var predefinedSymbols = newSymbolTable()
+
+// e.g. 12 (LOOP)
+func (d *Debugger) romName(addr int) string {
+	if d.program != nil {
+		if label, ok := d.program.LabelAt(addr); ok {
+			return fmt.Sprintf("%d (%s)", addr, label)
+		}
+	}
+
+	return strconv.Itoa(addr)
+}
+
+// e.g. RAM[16] (sum)
+func (d *Debugger) ramName(addr int) string {
+	var names []string
+
+	if d.program != nil {
+		for name, a := range d.program.Variables {
+			if a == addr {
+				names = append(names, name)
+			}
+		}
+	}
+
+	if len(names) == 0 {
+		return fmt.Sprintf("RAM[%d]", addr)
+	}
+
+	sort.Strings(names)
+
+	return fmt.Sprintf("RAM[%d] (%s)", addr, strings.Join(names, ", "))
+}
@@ -0,0 +1,113 @@
+package components
+
+import (
+	"bytes"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// Sums 1..RAM[0] into sum, leaving the result in RAM[1].
+const sumSource = `@i
+M=1
+@sum
+M=0
+(LOOP)
+@i
+D=M
+@R0
+D=D-M
+@STOP
+D;JGT
+@i
+D=M
+@sum
+M=D+M
+@i
+M=M+1
+@LOOP
+0;JMP
+(STOP)
+@sum
+D=M
+@R1
+M=D
+(END)
+@END
+0;JMP`
+
+func newTestDebugger(t *testing.T) (*Debugger, *bytes.Buffer) {
+	prog, err := AssembleProgram(sumSource)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c := NewHackComputer()
+	c.LoadProgram(prog)
+	c.RAM[0] = 4
+
+	var out bytes.Buffer
+
+	return NewDebugger(c, prog, &out), &out
+}
+
+func debug(t *testing.T, d *Debugger, commands ...string) {
+	for _, cmd := range commands {
+		if _, err := d.Command(cmd); err != nil {
+			t.Fatalf("%s: %s", cmd, err)
+		}
+	}
+}
+
+func TestBreakpoints(t *testing.T) {
+	d, out := newTestDebugger(t)
+
+	debug(t, d, "break STOP", "continue")
+
+	if d.computer.PC != uint16(d.program.Labels["STOP"]) {
+		t.Errorf("Expected to stop at STOP, PC is %d", d.computer.PC)
+	}
+
+	if !strings.Contains(out.String(), "// 21: @sum") {
+		t.Errorf("Expected the source line in the output, got:\n%s", out.String())
+	}
+
+	debug(t, d, "delete STOP", "continue")
+
+	if !d.computer.Halted() || d.computer.RAM[1] != 10 {
+		t.Errorf("Expected to run to the end with a sum of 10, got %d", d.computer.RAM[1])
+	}
+}
+
+func TestWatchpoints(t *testing.T) {
+	d, out := newTestDebugger(t)
+
+	debug(t, d, "watch sum", "continue", "continue", "continue")
+
+	if !strings.Contains(out.String(), "(sum): 1 -> 3") {
+		t.Errorf("Expected sum to change from 1 to 3, got:\n%s", out.String())
+	}
+}
+
+func TestNextStepsOverLoop(t *testing.T) {
+	d, _ := newTestDebugger(t)
+
+	// the jump back to LOOP, the instruction after it is STOP
+	jump := d.program.Labels["STOP"] - 1
+	debug(t, d, "break "+strconv.Itoa(jump), "continue", "delete "+strconv.Itoa(jump), "next")
+
+	if int(d.computer.PC) != d.program.Labels["STOP"] {
+		t.Errorf("Expected next to run to STOP, PC is %d", d.computer.PC)
+	}
+}
+
+func TestDebuggerErrors(t *testing.T) {
+	d, _ := newTestDebugger(t)
+
+	for _, cmd := range []string{"break NOWHERE", "watch nothing", "step -1", "mem", "wibble"} {
+		if _, err := d.Command(cmd); err == nil {
+			t.Errorf("Expected an error for %q", cmd)
+		}
+	}
+}
@@ -0,0 +1,496 @@
+/*
+ Autograding.  Every submission (a directory of .asm files, or a
+ single .asm file) is run against every test case, each run in a
+ directory and computer of its own so that nothing one does can affect
+ another.  Test cases are either the course's test scripts, a .tst
+ with its .cmp, or a pair of RAM files:
+
+	// Mult.in, the RAM before running
+	program Mult.asm
+	cycles 10000
+	RAM[0] 3
+	RAM[1] 5
+
+	// Mult.expected, the RAM after running for cycles, or until it
+	// halts if that's sooner
+	RAM[2] 15
+
+ A submission with just the one .asm file has it used whatever the
+ test case calls it.  The course's scripts load Xxx.hack, so that's
+ assembled from the submission's Xxx.asm.
+*/
+
+package components
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// TestCase is either a test script, or a RAM test.
+type TestCase struct {
+	Name     string
+	Script   string // path of the .tst, or empty for a RAM test
+	Program  string // RAM tests only, file name of the program to run
+	Cycles   int
+	Input    []RAMValue
+	Expected []RAMValue
+	dir      string // where the test's files are
+}
+
+// RAMValue is a value in a RAM test, Name being something like
+// RAM[16], or A, D or PC.
+type RAMValue struct {
+	Name  string
+	Value int
+}
+
+// Grade is the result of running one submission against one test case.
+type Grade struct {
+	Submission string `json:"submission"`
+	Test       string `json:"test"`
+	Passed     bool   `json:"passed"`
+	Mismatch   string `json:"mismatch,omitempty"` // the first thing that went wrong
+}
+
+const defaultTestCycles = 1000000
+
+// LoadTestCases reads the test cases in dir, in name order.
+func LoadTestCases(dir string) ([]TestCase, error) {
+	files, err := ioutil.ReadDir(dir)
+
+	if err != nil {
+		return nil, err
+	}
+
+	var cases []TestCase
+
+	for _, f := range files {
+		path := filepath.Join(dir, f.Name())
+		name := strings.TrimSuffix(f.Name(), filepath.Ext(f.Name()))
+
+		switch filepath.Ext(f.Name()) {
+		case ".tst":
+			cases = append(cases, TestCase{Name: name, Script: path, dir: dir})
+
+		case ".in":
+			tc, err := loadRAMTest(name, path, filepath.Join(dir, name+".expected"))
+
+			if err != nil {
+				return nil, err
+			}
+
+			tc.dir = dir
+			cases = append(cases, tc)
+		}
+	}
+
+	sort.Slice(cases, func(i, j int) bool { return cases[i].Name < cases[j].Name })
+
+	return cases, nil
+}
+
+func loadRAMTest(name, in, expected string) (TestCase, error) {
+	tc := TestCase{Name: name, Cycles: defaultTestCycles}
+
+	err := readRAMFile(in, func(words []string) error {
+		switch {
+		case words[0] == "program" && len(words) == 2:
+			tc.Program = words[1]
+			return nil
+
+		case words[0] == "cycles" && len(words) == 2:
+			n, err := strconv.Atoi(words[1])
+
+			if err != nil || n < 1 {
+				return fmt.Errorf("Invalid number of cycles: %s", words[1])
+			}
+
+			tc.Cycles = n
+			return nil
+		}
+
+		return tc.addValue(&tc.Input, words)
+	})
+
+	if err != nil {
+		return tc, err
+	}
+
+	if tc.Program == "" {
+		return tc, fmt.Errorf("%s: no program given", in)
+	}
+
+	return tc, readRAMFile(expected, func(words []string) error {
+		return tc.addValue(&tc.Expected, words)
+	})
+}
+
+func (tc *TestCase) addValue(values *[]RAMValue, words []string) error {
+	if len(words) != 2 {
+		return fmt.Errorf("Expected a name and a value: %s", strings.Join(words, " "))
+	}
+
+	v, err := parseScriptValue(words[1])
+
+	switch words[0] {
+	case "A", "D", "PC":
+	default:
+		if err == nil {
+			_, _, err = (&cpuTarget{}).memory(words[0])
+		}
+	}
+
+	*values = append(*values, RAMValue{words[0], v})
+
+	return err
+}
+
+// Calls f with the words on each line of path, skipping blank lines
+// and comments.
+func readRAMFile(path string, f func([]string) error) error {
+	file, err := os.Open(path)
+
+	if err != nil {
+		return err
+	}
+
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	lineNum := 0
+
+	for scanner.Scan() {
+		lineNum++
+		line := scanner.Text()
+
+		if i := strings.Index(line, "//"); i >= 0 {
+			line = line[:i]
+		}
+
+		if words := strings.Fields(line); len(words) > 0 {
+			if err := f(words); err != nil {
+				return fmt.Errorf("%s, line %d: %s", path, lineNum, err)
+			}
+		}
+	}
+
+	return scanner.Err()
+}
+
+// Submissions lists the submissions in dir, each a directory or .asm
+// file.
+func Submissions(dir string) ([]string, error) {
+	files, err := ioutil.ReadDir(dir)
+
+	if err != nil {
+		return nil, err
+	}
+
+	var paths []string
+
+	for _, f := range files {
+		if f.IsDir() || strings.ToLower(filepath.Ext(f.Name())) == ".asm" {
+			paths = append(paths, filepath.Join(dir, f.Name()))
+		}
+	}
+
+	return paths, nil
+}
+
+// GradeSubmissions runs every submission against every test case,
+// using up to workers at once, each test run being given up on after
+// timeout.  Grades are by submission, then test case.
+func GradeSubmissions(submissions []string, cases []TestCase, workers int, timeout time.Duration) []Grade {
+	grades := make([]Grade, len(submissions)*len(cases))
+	jobs := make(chan int)
+
+	var wg sync.WaitGroup
+
+	for w := 0; w < max(1, min(workers, len(grades))); w++ {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			for i := range jobs {
+				grades[i] = grade(submissions[i/len(cases)], cases[i%len(cases)], timeout)
+			}
+		}()
+	}
+
+	for i := range grades {
+		jobs <- i
+	}
+
+	close(jobs)
+	wg.Wait()
+
+	return grades
+}
+
+// A panic fails the one grade, rather than the whole batch.
+func grade(submission string, tc TestCase, timeout time.Duration) (g Grade) {
+	g = Grade{Submission: filepath.Base(submission), Test: tc.Name}
+
+	defer func() {
+		if r := recover(); r != nil {
+			g.Passed = false
+			g.Mismatch = fmt.Sprintf("Grader panic: %v", r)
+		}
+	}()
+
+	dir, err := ioutil.TempDir("", "n2t-grade")
+
+	if err == nil {
+		defer os.RemoveAll(dir)
+		err = sandbox(dir, submission, tc)
+	}
+
+	if err == nil {
+		deadline := time.Now().Add(timeout)
+
+		if tc.Script != "" {
+			err = runTestScriptUntil(filepath.Join(dir, filepath.Base(tc.Script)), &cpuTarget{NewHackComputer()}, deadline)
+		} else {
+			err = tc.run(dir, deadline)
+		}
+	}
+
+	if err != nil {
+		g.Mismatch = err.Error()
+	}
+
+	g.Passed = err == nil
+
+	return g
+}
+
+// Copies the files the test case needs, and then the submission's
+// .asm files, into dir.  A submission of a single file is named as the
+// test case expects, and if a script loads a .hack file it's assembled
+// from the .asm of the same name.
+func sandbox(dir, submission string, tc TestCase) error {
+	program, needs, err := tc.files()
+
+	if err != nil {
+		return err
+	}
+
+	asms, err := filesIn(submission, ".asm")
+
+	if err != nil {
+		return err
+	}
+
+	for _, path := range needs {
+		if err := copyFile(path, filepath.Join(dir, filepath.Base(path))); err != nil {
+			return err
+		}
+	}
+
+	source := strings.TrimSuffix(program, filepath.Ext(program)) + ".asm"
+
+	for _, path := range asms {
+		name := filepath.Base(path)
+
+		if len(asms) == 1 && program != "" {
+			name = source
+		}
+
+		if err := copyFile(path, filepath.Join(dir, name)); err != nil {
+			return err
+		}
+	}
+
+	if strings.ToLower(filepath.Ext(program)) != ".hack" {
+		return nil
+	}
+
+	return assembleHack(filepath.Join(dir, source), filepath.Join(dir, program))
+}
+
+// The program the test case runs, and the files it needs from the
+// test directory; a script and whatever it compares to.
+func (tc *TestCase) files() (string, []string, error) {
+	if tc.Script == "" {
+		return tc.Program, nil, nil
+	}
+
+	b, err := ioutil.ReadFile(tc.Script)
+
+	if err != nil {
+		return "", nil, err
+	}
+
+	tokens, err := tokeniseScript(string(b))
+
+	if err != nil {
+		return "", nil, err
+	}
+
+	program := ""
+	needs := []string{tc.Script}
+
+	for i := 0; i+1 < len(tokens); i++ {
+		switch tokens[i].value {
+		case "load":
+			if ext := strings.ToLower(filepath.Ext(tokens[i+1].value)); ext == ".asm" || ext == ".hack" {
+				program = tokens[i+1].value
+			}
+
+		case "compare-to":
+			needs = append(needs, filepath.Join(tc.dir, tokens[i+1].value))
+		}
+	}
+
+	return program, needs, nil
+}
+
+// Assembles source to hack.  A missing source is left for loading
+// the .hack to report.
+func assembleHack(source, hack string) error {
+	b, err := ioutil.ReadFile(source)
+
+	if err != nil {
+		return nil
+	}
+
+	prog, err := AssembleProgram(string(b))
+
+	if err != nil {
+		return fmt.Errorf("Doesn't assemble: %s", err)
+	}
+
+	out, err := os.Create(hack)
+
+	if err != nil {
+		return err
+	}
+
+	if err := WriteHack(out, prog.words); err != nil {
+		out.Close()
+		return err
+	}
+
+	return out.Close()
+}
+
+// The files in dir with the given extension (any if empty), or just
+// path if it's a file.
+func filesIn(path, ext string) ([]string, error) {
+	info, err := os.Stat(path)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if !info.IsDir() {
+		return []string{path}, nil
+	}
+
+	files, err := ioutil.ReadDir(path)
+
+	if err != nil {
+		return nil, err
+	}
+
+	var paths []string
+
+	for _, f := range files {
+		if !f.IsDir() && (ext == "" || strings.ToLower(filepath.Ext(f.Name())) == ext) {
+			paths = append(paths, filepath.Join(path, f.Name()))
+		}
+	}
+
+	return paths, nil
+}
+
+func copyFile(from, to string) error {
+	b, err := ioutil.ReadFile(from)
+
+	if err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(to, b, 0644)
+}
+
+// Runs a RAM test in dir, the first mismatch being the error.
+func (tc *TestCase) run(dir string, deadline time.Time) error {
+	b, err := ioutil.ReadFile(filepath.Join(dir, tc.Program))
+
+	if err != nil {
+		return fmt.Errorf("Missing %s", tc.Program)
+	}
+
+	prog, err := AssembleProgram(string(b))
+
+	if err != nil {
+		return fmt.Errorf("Doesn't assemble: %s", err)
+	}
+
+	c := &cpuTarget{NewHackComputer()}
+	c.LoadProgram(prog)
+
+	for _, v := range tc.Input {
+		if err := c.set(v.Name, v.Value); err != nil {
+			return err
+		}
+	}
+
+	// in chunks, to keep an eye on the time, with halting just
+	// finishing early
+	for cycles := 0; cycles < tc.Cycles && !c.Halted(); {
+		if time.Now().After(deadline) {
+			return fmt.Errorf("Timed out after %d cycles", cycles)
+		}
+
+		cycles += c.Run(min(10000, tc.Cycles-cycles))
+	}
+
+	for _, v := range tc.Expected {
+		if actual, _ := c.get(v.Name); actual != v.Value {
+			return fmt.Errorf("%s: expected %d, got %d", v.Name, v.Value, actual)
+		}
+	}
+
+	return nil
+}
+
+// WriteGradesCSV writes grades as CSV, with a header row.
+func WriteGradesCSV(w io.Writer, grades []Grade) error {
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"submission", "test", "passed", "mismatch"})
+
+	for _, g := range grades {
+		cw.Write([]string{g.Submission, g.Test, strconv.FormatBool(g.Passed), g.Mismatch})
+	}
+
+	cw.Flush()
+
+	return cw.Error()
+}
+
+// WriteGradesJSON writes grades as a JSON array.
+func WriteGradesJSON(w io.Writer, grades []Grade) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+
+	if grades == nil {
+		grades = []Grade{}
+	}
+
+	return enc.Encode(grades)
+}
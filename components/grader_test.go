@@ -0,0 +1,205 @@
+package components
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Stores the smaller instead.
+const maxWrong = `@R0
+D=M
+@R1
+D=D-M
+@FIRST
+D;JLT
+@R1
+D=M
+@STORE
+0;JMP
+(FIRST)
+@R0
+D=M
+(STORE)
+@R2
+M=D
+(END)
+@END
+0;JMP`
+
+func writeFiles(t *testing.T, dir string, files map[string]string) {
+	for name, contents := range files {
+		path := filepath.Join(dir, name)
+		os.MkdirAll(filepath.Dir(path), 0755)
+
+		if err := ioutil.WriteFile(path, []byte(contents), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestGradeSubmissions(t *testing.T) {
+	dir, err := ioutil.TempDir("", "n2t-grader")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.RemoveAll(dir)
+
+	maxSource, _ := ioutil.ReadFile("testdata/Max.asm")
+	tst, _ := ioutil.ReadFile("testdata/Max.tst")
+	cmp, _ := ioutil.ReadFile("testdata/Max.cmp")
+
+	writeFiles(t, dir, map[string]string{
+		"tests/Max.tst":             string(tst),
+		"tests/Max.cmp":             string(cmp),
+		"tests/MaxRAM.in":           "program Max.asm\ncycles 100\nRAM[0] 7 // the bigger\nRAM[1] 2\n",
+		"tests/MaxRAM.expected":     "RAM[2] 7\n",
+		"submissions/alice/Max.asm": string(maxSource),
+		"submissions/bob.asm":       maxWrong,
+		"submissions/carol/Max.asm": "(LOOP)\n@LOOP\nD;JEQ",
+		"submissions/dave/Nope.asm": string(maxSource),
+		"submissions/dave/Max.asm":  "D=Q",
+		"submissions/erin/Max.asm":  strings.Replace(string(maxSource), "(END)", "(END)\n@R3\nM=M+1", 1),
+	})
+
+	cases, err := LoadTestCases(filepath.Join(dir, "tests"))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(cases) != 2 || cases[1].Program != "Max.asm" || cases[1].Cycles != 100 || len(cases[1].Input) != 2 {
+		t.Fatalf("Unexpected test cases: %+v", cases)
+	}
+
+	submissions, err := Submissions(filepath.Join(dir, "submissions"))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	grades := GradeSubmissions(submissions, cases, 3, time.Minute)
+
+	expected := []struct {
+		submission, test string
+		mismatch         string // empty for a pass
+	}{
+		{"alice", "Max", ""},
+		{"alice", "MaxRAM", ""},
+		{"bob.asm", "Max", "Comparison failure at line 2"},
+		{"bob.asm", "MaxRAM", "RAM[2]: expected 7, got 2"},
+		{"carol", "Max", "Comparison failure at line 2"},
+		{"carol", "MaxRAM", "RAM[2]: expected 7, got 0"},
+		{"dave", "Max", "Unrecognised instruction: Q"},
+		{"dave", "MaxRAM", "Doesn't assemble"},
+		{"erin", "Max", ""},
+		{"erin", "MaxRAM", ""}, // never halts, but has the answer in time
+	}
+
+	if len(grades) != len(expected) {
+		t.Fatalf("Expected %d grades, got %+v", len(expected), grades)
+	}
+
+	for i, e := range expected {
+		g := grades[i]
+
+		if g.Submission != e.submission || g.Test != e.test || g.Passed != (e.mismatch == "") ||
+			!strings.Contains(g.Mismatch, e.mismatch) {
+			t.Errorf("Expected %+v, got %+v", e, g)
+		}
+	}
+
+	var b bytes.Buffer
+
+	if err := WriteGradesCSV(&b, grades[:3]); err != nil {
+		t.Fatal(err)
+	}
+
+	if lines := strings.Split(b.String(), "\n"); lines[0] != "submission,test,passed,mismatch" || lines[1] != "alice,Max,true," {
+		t.Errorf("Unexpected CSV:\n%s", b.String())
+	}
+
+	b.Reset()
+
+	if err := WriteGradesJSON(&b, grades); err != nil {
+		t.Fatal(err)
+	}
+
+	var read []Grade
+
+	if err := json.Unmarshal(b.Bytes(), &read); err != nil || len(read) != len(grades) || read[3] != grades[3] {
+		t.Errorf("JSON didn't round trip, %v:\n%s", err, b.String())
+	}
+}
+
+func TestGradeTimeout(t *testing.T) {
+	dir, err := ioutil.TempDir("", "n2t-grader")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.RemoveAll(dir)
+
+	writeFiles(t, dir, map[string]string{
+		"tests/Forever.tst": "load Forever.asm;\nwhile RAM[0] = 0 {\n  ticktock;\n}\n",
+		"Forever.asm":       "(LOOP)\n@LOOP\nD;JEQ",
+	})
+
+	cases, err := LoadTestCases(filepath.Join(dir, "tests"))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	grades := GradeSubmissions([]string{filepath.Join(dir, "Forever.asm")}, cases, 1, 50*time.Millisecond)
+
+	if grades[0].Passed || !strings.HasPrefix(grades[0].Mismatch, "Timed out") {
+		t.Errorf("Expected a time out, got %+v", grades[0])
+	}
+}
+
+// The course's Mult.tst, which loads Mult.hack.
+func TestGradeCourseScript(t *testing.T) {
+	cases, err := LoadTestCases("testdata/mult")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	grades := GradeSubmissions([]string{"testdata/Mult.asm", "testdata/Max.asm"}, cases, 2, time.Minute)
+
+	if len(grades) != 2 || !grades[0].Passed || grades[1].Passed || !strings.Contains(grades[1].Mismatch, "Comparison failure at line 3") {
+		t.Errorf("Expected Mult.asm to pass and Max.asm to fail, got %+v", grades)
+	}
+
+	dir, err := ioutil.TempDir("", "n2t-grader")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.RemoveAll(dir)
+
+	if err := sandbox(dir, "testdata/Mult.asm", cases[0]); err != nil {
+		t.Fatal(err)
+	}
+
+	files, _ := ioutil.ReadDir(dir)
+	var names []string
+
+	for _, f := range files {
+		names = append(names, f.Name())
+	}
+
+	if strings.Join(names, " ") != "Mult.asm Mult.cmp Mult.hack Mult.tst" {
+		t.Errorf("Expected just the script, its .cmp and the program in the sandbox, got %v", names)
+	}
+}
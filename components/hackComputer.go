@@ -0,0 +1,309 @@
+package components
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+// Memory map of the Hack platform.
+
+const romSize = 32768
+const ramSize = 32768
+
+const screenBase = 16384
+const kbdAddress = 24576
+
+// HackComputer emulates the Hack platform from chapter 5; a CPU with
+// A, D and PC registers, 32K of ROM holding the program and 32K of
+// RAM, with the screen and keyboard memory mapped in at SCREEN and
+// KBD.
+type HackComputer struct {
+	ROM       [romSize]asm
+	RAM       [ramSize]int16
+	A         int16
+	D         int16
+	PC        uint16
+	Time      int // number of instructions executed since the last reset
+	keys      KeyScript
+	nextKey   int // index into keys of the next event, rewound by Reset
+	observers []func(TraceRecord)
+}
+
+// NewHackComputer returns a computer with empty ROM and RAM.
+func NewHackComputer() *HackComputer {
+	return &HackComputer{}
+}
+
+// Reset sets the PC (and clock) back to zero, leaving memory alone,
+// the same as holding down the reset button for a cycle.  Any key
+// script starts again from the beginning.
+func (c *HackComputer) Reset() {
+	c.PC = 0
+	c.Time = 0
+	c.nextKey = 0
+}
+
+// LoadFile loads either a .hack or an .asm file into ROM, assembling
+// the latter first.
+func (c *HackComputer) LoadFile(name string) error {
+	b, err := ioutil.ReadFile(name)
+
+	if err != nil {
+		return err
+	}
+
+	if strings.ToLower(filepath.Ext(name)) == ".asm" {
+		return c.LoadAsm(string(b))
+	}
+
+	return c.LoadHack(strings.NewReader(string(b)))
+}
+
+// LoadAsm assembles source and loads the result into ROM.
+func (c *HackComputer) LoadAsm(source string) error {
+	words, err := assemble(source)
+
+	if err != nil {
+		return err
+	}
+
+	c.loadWords(words)
+
+	return nil
+}
+
+// LoadHack reads "binary" machine code, one 16 character line per
+// instruction, into ROM.
+func (c *HackComputer) LoadHack(r io.Reader) error {
+	words, err := readHack(r)
+
+	if err != nil {
+		return err
+	}
+
+	c.loadWords(words)
+
+	return nil
+}
+
+// readHack reads "binary" machine code, one 16 character line per
+// instruction.
+func readHack(r io.Reader) ([]asm, error) {
+	var words []asm
+	lineNum := 0
+	scanner := bufio.NewScanner(r)
+
+	for scanner.Scan() {
+		lineNum++
+		line := strings.TrimSpace(scanner.Text())
+
+		if line == "" {
+			continue
+		}
+
+		w, err := strconv.ParseUint(line, 2, 16)
+
+		if err != nil || len(line) != 16 {
+			return nil, fmt.Errorf("Invalid machine instruction, line %d: %s", lineNum, line)
+		}
+
+		words = append(words, asm(w))
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	if len(words) > romSize {
+		return nil, fmt.Errorf("Program too large for ROM: %d instructions", len(words))
+	}
+
+	return words, nil
+}
+
+func (c *HackComputer) loadWords(words []asm) {
+	c.ROM = [romSize]asm{}
+	copy(c.ROM[:], words)
+	c.Reset()
+}
+
+// Step executes the instruction at PC.
+func (c *HackComputer) Step() {
+	if c.nextKey < len(c.keys) {
+		c.pressKeys()
+	}
+
+	pc := c.PC
+	i := c.ROM[pc]
+	c.Time++
+
+	wrote, addr := c.execute(i)
+
+	if len(c.observers) == 0 {
+		return
+	}
+
+	r := TraceRecord{
+		PC:          pc,
+		Instruction: uint16(i),
+		A:           c.A,
+		D:           c.D,
+		Wrote:       wrote,
+		Address:     addr,
+		Value:       c.RAM[addr],
+	}
+
+	for _, o := range c.observers {
+		o(r)
+	}
+}
+
+// Executes i, returning whether it wrote to RAM and if so where.
+func (c *HackComputer) execute(i asm) (bool, uint16) {
+	if i&cInst != cInst {
+		c.A = int16(i)
+		c.PC++
+		return false, 0
+	}
+
+	addr := uint16(c.A) % ramSize
+	out := alu(c.D, c.aluY(i), i)
+	wrote := i&destM != 0
+
+	if wrote {
+		c.RAM[addr] = out
+	}
+
+	if i&destD != 0 {
+		c.D = out
+	}
+
+	oldA := uint16(c.A)
+
+	if i&destA != 0 {
+		c.A = out
+	}
+
+	if jumps(out, i) {
+		c.PC = oldA % romSize
+	} else {
+		c.PC++
+	}
+
+	return wrote, addr
+}
+
+// Observe registers f to be called after every instruction executed,
+// for tracing and profiling.
+func (c *HackComputer) Observe(f func(TraceRecord)) {
+	c.observers = append(c.observers, f)
+}
+
+// Run executes up to n instructions, stopping early if the program
+// halts.  Returns the number of instructions actually executed.
+func (c *HackComputer) Run(n int) int {
+	for i := 0; i < n; i++ {
+		if c.Halted() {
+			return i
+		}
+
+		c.Step()
+	}
+
+	return n
+}
+
+// Halted is true when the program is sitting in the usual end of
+// program loop:
+//
+//	(END)
+//	@END
+//	0;JMP
+//
+// i.e. the current instruction loads its own address into A, and the
+// following one is an unconditional jump.
+func (c *HackComputer) Halted() bool {
+	here := c.ROM[c.PC]
+	next := c.ROM[(c.PC+1)%romSize]
+
+	return here == aInst|asm(c.PC) &&
+		next&cInst == cInst &&
+		next&jmpJMP == jmpJMP &&
+		next&(destA|destM) == 0
+}
+
+// The 'y' input to the ALU is A, or M if the a-bit is set.
+func (c *HackComputer) aluY(i asm) int16 {
+	if i&aBit != 0 {
+		return c.RAM[uint16(c.A)%ramSize]
+	}
+
+	return c.A
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// Decoding - rather than look the parts up in cmpMap etc, follow the
+// control bits the same way the hardware does.
+
+const aBit asm = 1 << 12
+const aluZX asm = 1 << 11
+const aluNX asm = 1 << 10
+const aluZY asm = 1 << 9
+const aluNY asm = 1 << 8
+const aluF asm = 1 << 7
+const aluNO asm = 1 << 6
+
+const destA asm = 1 << 5
+const destD asm = 1 << 4
+const destM asm = 1 << 3
+
+const jmpJLT asm = 1 << 2
+const jmpJEQ asm = 1 << 1
+const jmpJGT asm = 1
+const jmpJMP = jmpJLT | jmpJEQ | jmpJGT
+
+func alu(x, y int16, i asm) int16 {
+	if i&aluZX != 0 {
+		x = 0
+	}
+
+	if i&aluNX != 0 {
+		x = ^x
+	}
+
+	if i&aluZY != 0 {
+		y = 0
+	}
+
+	if i&aluNY != 0 {
+		y = ^y
+	}
+
+	var out int16
+
+	if i&aluF != 0 {
+		out = x + y
+	} else {
+		out = x & y
+	}
+
+	if i&aluNO != 0 {
+		out = ^out
+	}
+
+	return out
+}
+
+func jumps(out int16, i asm) bool {
+	lt := i&jmpJLT != 0 && out < 0
+	eq := i&jmpJEQ != 0 && out == 0
+	gt := i&jmpJGT != 0 && out > 0
+
+	return lt || eq || gt
+}
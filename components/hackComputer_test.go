@@ -0,0 +1,52 @@
+package components
+
+import "testing"
+
+// D = 5, A = 3 and M (RAM[3]) = 7
+var compTests = map[string]int16{
+	"0": 0, "1": 1, "-1": -1,
+	"D": 5, "A": 3, "M": 7,
+	"!D": ^5, "!A": ^3, "!M": ^7,
+	"-D": -5, "-A": -3, "-M": -7,
+	"D+1": 6, "A+1": 4, "M+1": 8,
+	"D-1": 4, "A-1": 2, "M-1": 6,
+	"D+A": 8, "D+M": 12,
+	"D-A": 2, "D-M": -2,
+	"A-D": -2, "M-D": 2,
+	"D&A": 1, "D&M": 5,
+	"D|A": 7, "D|M": 7,
+}
+
+func TestALU(t *testing.T) {
+	for comp, expected := range compTests {
+		c := NewHackComputer()
+		c.ROM[0] = cInst | cmpMap[comp] | destMap["D"]
+		c.D, c.A, c.RAM[3] = 5, 3, 7
+
+		c.Step()
+
+		if c.D != expected {
+			t.Errorf("%s: expected %d, got %d", comp, expected, c.D)
+		}
+	}
+}
+
+func TestRunMax(t *testing.T) {
+	c := NewHackComputer()
+	words, err := assemble("@R0\nD=M\n@R1\nD=D-M\n@FIRST\nD;JGT\n@R1\nD=M\n@STORE\n0;JMP\n(FIRST)\n@R0\nD=M\n(STORE)\n@R2\nM=D\n(END)\n@END\n0;JMP")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c.loadWords(words)
+	c.RAM[0], c.RAM[1] = -4, 9
+
+	if n := c.Run(1000); n == 1000 || !c.Halted() {
+		t.Errorf("Expected program to halt, ran %d instructions.", n)
+	}
+
+	if c.RAM[2] != 9 {
+		t.Errorf("Expected max of 9, got %d", c.RAM[2])
+	}
+}
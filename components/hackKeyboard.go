@@ -0,0 +1,155 @@
+package components
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+// Hack key codes for the keys that aren't printable characters.  Those
+// that are use their ASCII code.
+
+const (
+	KeyNone      int16 = 0
+	KeyNewline   int16 = 128
+	KeyBackspace int16 = 129
+	KeyLeft      int16 = 130
+	KeyUp        int16 = 131
+	KeyRight     int16 = 132
+	KeyDown      int16 = 133
+	KeyHome      int16 = 134
+	KeyEnd       int16 = 135
+	KeyPageUp    int16 = 136
+	KeyPageDown  int16 = 137
+	KeyInsert    int16 = 138
+	KeyDelete    int16 = 139
+	KeyEsc       int16 = 140
+	KeyF1        int16 = 141 // F2 - F12 follow on from here
+)
+
+var keyNames = map[string]int16{
+	"NONE":      KeyNone,
+	"SPACE":     ' ',
+	"NEWLINE":   KeyNewline,
+	"ENTER":     KeyNewline,
+	"BACKSPACE": KeyBackspace,
+	"LEFT":      KeyLeft,
+	"UP":        KeyUp,
+	"RIGHT":     KeyRight,
+	"DOWN":      KeyDown,
+	"HOME":      KeyHome,
+	"END":       KeyEnd,
+	"PAGEUP":    KeyPageUp,
+	"PAGEDOWN":  KeyPageDown,
+	"INSERT":    KeyInsert,
+	"DELETE":    KeyDelete,
+	"ESC":       KeyEsc,
+}
+
+func init() {
+	for i := int16(0); i < 12; i++ {
+		keyNames[fmt.Sprintf("F%d", i+1)] = KeyF1 + i
+	}
+}
+
+// KeyEvent puts Key in the keyboard register once the computer has
+// run for Cycle cycles.  It stays there until the next event, so
+// releasing a key is an event with KeyNone.
+type KeyEvent struct {
+	Cycle int
+	Key   int16
+}
+
+// KeyScript is a list of key events, in order of cycle.
+type KeyScript []KeyEvent
+
+// ParseKeyScript reads one event per line, as the cycle followed by
+// the key:
+//
+//	// hold left for a bit, then let go
+//	1000 LEFT
+//	5000 NONE
+//	6000 q
+//
+// A key is either a single character, one of the names in keyNames
+// (LEFT, ENTER, F1 etc), or the key code as a number.
+func ParseKeyScript(r io.Reader) (KeyScript, error) {
+	var script KeyScript
+	lineNum := 0
+	scanner := bufio.NewScanner(r)
+
+	for scanner.Scan() {
+		lineNum++
+		line := scanner.Text()
+
+		if i := strings.Index(line, "//"); i != -1 {
+			line = line[:i]
+		}
+
+		fields := strings.Fields(line)
+
+		if len(fields) == 0 {
+			continue
+		}
+
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("Expected a cycle and a key, line %d: %s", lineNum, line)
+		}
+
+		cycle, err := strconv.Atoi(fields[0])
+
+		if err != nil || cycle < 0 {
+			return nil, fmt.Errorf("Invalid cycle, line %d: %s", lineNum, fields[0])
+		}
+
+		key, err := parseKey(fields[1])
+
+		if err != nil {
+			return nil, fmt.Errorf("%s, line %d", err, lineNum)
+		}
+
+		if n := len(script); n > 0 && script[n-1].Cycle > cycle {
+			return nil, fmt.Errorf("Events out of order, line %d", lineNum)
+		}
+
+		script = append(script, KeyEvent{cycle, key})
+	}
+
+	return script, scanner.Err()
+}
+
+func parseKey(s string) (int16, error) {
+	if len(s) == 1 {
+		return int16(s[0]), nil
+	}
+
+	if k, ok := keyNames[strings.ToUpper(s)]; ok {
+		return k, nil
+	}
+
+	if k, err := strconv.Atoi(s); err == nil && k >= 0 && k <= 32767 {
+		return int16(k), nil
+	}
+
+	return 0, fmt.Errorf("Unrecognised key: %s", s)
+}
+
+// SetKeyScript replaces any existing key script; events are applied
+// as Step reaches their cycle, and again from the start after a Reset.
+func (c *HackComputer) SetKeyScript(script KeyScript) {
+	c.keys = append(KeyScript(nil), script...)
+	c.nextKey = 0
+	sort.SliceStable(c.keys, func(i, j int) bool { return c.keys[i].Cycle < c.keys[j].Cycle })
+}
+
+// Puts any keys that are due into the keyboard register.
+func (c *HackComputer) pressKeys() {
+	for c.nextKey < len(c.keys) && c.keys[c.nextKey].Cycle <= c.Time {
+		c.RAM[kbdAddress] = c.keys[c.nextKey].Key
+		c.nextKey++
+	}
+}
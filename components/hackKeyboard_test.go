@@ -0,0 +1,60 @@
+package components
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseKeyScript(t *testing.T) {
+	src := "// comment\n10 LEFT\n\n20 q // quit\n30 none\n40 f12\n50 200\n"
+	expected := KeyScript{{10, KeyLeft}, {20, 'q'}, {30, KeyNone}, {40, KeyF1 + 11}, {50, 200}}
+
+	script, err := ParseKeyScript(strings.NewReader(src))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(script) != len(expected) {
+		t.Fatalf("Expected %d events, got %d", len(expected), len(script))
+	}
+
+	for i := range expected {
+		if script[i] != expected[i] {
+			t.Errorf("Expected %v, got %v", expected[i], script[i])
+		}
+	}
+
+	for _, bad := range []string{"10", "x LEFT", "10 WIBBLE", "20 a\n10 b"} {
+		if _, err := ParseKeyScript(strings.NewReader(bad)); err == nil {
+			t.Errorf("Expected an error for %q", bad)
+		}
+	}
+}
+
+func TestKeyScriptDrivesKBD(t *testing.T) {
+	c := NewHackComputer()
+
+	// copies KBD into R0 forever
+	if err := c.LoadAsm("D=0\n(LOOP)\n@KBD\nD=M\n@R0\nM=D\n@LOOP\n0;JMP"); err != nil {
+		t.Fatal(err)
+	}
+
+	c.SetKeyScript(KeyScript{{60, KeyUp}, {120, KeyNone}})
+
+	// and the same again after a reset
+	for run := 0; run < 2; run++ {
+		c.Reset()
+
+		for _, check := range []struct {
+			cycles   int
+			expected int16
+		}{{60, KeyNone}, {60, KeyUp}, {60, KeyNone}} {
+			c.Run(check.cycles)
+
+			if c.RAM[0] != check.expected {
+				t.Errorf("Run %d, at cycle %d, expected R0 of %d, got %d", run+1, c.Time, check.expected, c.RAM[0])
+			}
+		}
+	}
+}
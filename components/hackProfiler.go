@@ -0,0 +1,158 @@
+package components
+
+import (
+	"fmt"
+	"io"
+	"sort"
+)
+
+// Profiler counts the cycles spent at each ROM address.  With a
+// Program it can also total them up per label, where a label's range
+// runs up to the next label.
+type Profiler struct {
+	program *Program // may be nil
+	counts  [romSize]int
+	total   int
+}
+
+// NewProfiler returns a profiler, use its Record method with Observe.
+func NewProfiler(prog *Program) *Profiler {
+	return &Profiler{program: prog}
+}
+
+// Record counts a single cycle.
+func (p *Profiler) Record(r TraceRecord) {
+	p.counts[r.PC%romSize]++
+	p.total++
+}
+
+// Cycles returns the number of cycles spent at addr.
+func (p *Profiler) Cycles(addr int) int {
+	return p.counts[addr]
+}
+
+// ProfileEntry is the number of cycles spent in an address range.
+type ProfileEntry struct {
+	Name   string // the label or, for a single address, its disassembly
+	Start  int
+	End    int // exclusive
+	Cycles int
+}
+
+// Addresses returns the top n addresses by cycles spent.
+func (p *Profiler) Addresses(n int) []ProfileEntry {
+	var entries []ProfileEntry
+
+	for addr, count := range p.counts {
+		if count > 0 {
+			entries = append(entries, ProfileEntry{"", addr, addr + 1, count})
+		}
+	}
+
+	entries = topEntries(entries, n)
+
+	for i := range entries {
+		entries[i].Name = p.describe(entries[i].Start)
+	}
+
+	return entries
+}
+
+// Labels returns the top n label ranges by cycles spent.  Anything
+// before the first label is counted against "(start)".
+func (p *Profiler) Labels(n int) []ProfileEntry {
+	if p.program == nil {
+		return nil
+	}
+
+	starts := map[int]string{0: "(start)"}
+
+	// where labels share an address, go with the same one as LabelAt
+	for label, addr := range p.program.Labels {
+		if existing, ok := starts[addr]; !ok || existing == "(start)" || label < existing {
+			starts[addr] = label
+		}
+	}
+
+	var addrs []int
+
+	for addr := range starts {
+		addrs = append(addrs, addr)
+	}
+
+	sort.Ints(addrs)
+
+	var entries []ProfileEntry
+
+	for i, start := range addrs {
+		end := romSize
+
+		if i+1 < len(addrs) {
+			end = addrs[i+1]
+		}
+
+		e := ProfileEntry{Name: starts[start], Start: start, End: end}
+
+		for addr := start; addr < end; addr++ {
+			e.Cycles += p.counts[addr]
+		}
+
+		if e.Cycles > 0 {
+			entries = append(entries, e)
+		}
+	}
+
+	return topEntries(entries, n)
+}
+
+// WriteReport writes the top n label ranges and addresses as a table.
+func (p *Profiler) WriteReport(w io.Writer, n int) {
+	fmt.Fprintf(w, "Total cycles: %d\n", p.total)
+
+	if labels := p.Labels(n); labels != nil {
+		fmt.Fprintf(w, "\nHottest labels:\n")
+		p.writeEntries(w, labels)
+	}
+
+	fmt.Fprintf(w, "\nHottest addresses:\n")
+	p.writeEntries(w, p.Addresses(n))
+}
+
+func (p *Profiler) writeEntries(w io.Writer, entries []ProfileEntry) {
+	for _, e := range entries {
+		percent := 100 * float64(e.Cycles) / float64(max(p.total, 1))
+		fmt.Fprintf(w, "%12d %6.2f%%  %5d-%-5d  %s\n", e.Cycles, percent, e.Start, e.End-1, e.Name)
+	}
+}
+
+// The instruction at addr, with its source if known.
+func (p *Profiler) describe(addr int) string {
+	if p.program != nil {
+		if n, src, ok := p.program.SourceLine(addr); ok {
+			return fmt.Sprintf("%d: %s", n, src)
+		}
+
+		if addr < len(p.program.words) {
+			return disassemble(p.program.words[addr])
+		}
+	}
+
+	return fmt.Sprintf("ROM[%d]", addr)
+}
+
+// Sorts by cycles, most first (then by address to be deterministic)
+// and keeps the first n.
+func topEntries(entries []ProfileEntry, n int) []ProfileEntry {
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].Cycles != entries[j].Cycles {
+			return entries[i].Cycles > entries[j].Cycles
+		}
+		return entries[i].Start < entries[j].Start
+	})
+
+	if n > 0 && len(entries) > n {
+		entries = entries[:n]
+	}
+
+	return entries
+}
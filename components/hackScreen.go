@@ -0,0 +1,40 @@
+package components
+
+import (
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+)
+
+const screenWidth = 512
+const screenHeight = 256
+
+// Each row of the screen is 32 words, with the least significant bit
+// of each word being its leftmost pixel.
+const screenRowWords = screenWidth / 16
+
+// Screen returns the 512x256 bitmap memory mapped from SCREEN as an
+// image; set bits are black, clear ones white.
+func (c *HackComputer) Screen() *image.Paletted {
+	palette := color.Palette{color.White, color.Black}
+	img := image.NewPaletted(image.Rect(0, 0, screenWidth, screenHeight), palette)
+
+	for y := 0; y < screenHeight; y++ {
+		for x := 0; x < screenWidth; x++ {
+			word := uint16(c.RAM[screenBase+y*screenRowWords+x/16])
+
+			if word&(1<<uint(x%16)) != 0 {
+				img.Pix[y*img.Stride+x] = 1
+			}
+		}
+	}
+
+	return img
+}
+
+// WriteScreenPNG writes the current contents of the screen to w as a
+// PNG.
+func (c *HackComputer) WriteScreenPNG(w io.Writer) error {
+	return png.Encode(w, c.Screen())
+}
@@ -0,0 +1,43 @@
+package components
+
+import (
+	"bytes"
+	"image/png"
+	"testing"
+)
+
+func TestScreenPNG(t *testing.T) {
+	c := NewHackComputer()
+
+	// top left pixel, and the last pixel of the second row
+	c.RAM[screenBase] = 1
+	c.RAM[screenBase+2*screenRowWords-1] = -32768
+
+	var buf bytes.Buffer
+
+	if err := c.WriteScreenPNG(&buf); err != nil {
+		t.Fatal(err)
+	}
+
+	img, err := png.Decode(&buf)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if b := img.Bounds(); b.Dx() != 512 || b.Dy() != 256 {
+		t.Fatalf("Expected a 512x256 image, got %dx%d", b.Dx(), b.Dy())
+	}
+
+	black := map[[2]int]bool{{0, 0}: true, {511, 1}: true}
+
+	for y := 0; y < 256; y++ {
+		for x := 0; x < 512; x++ {
+			r, _, _, _ := img.At(x, y).RGBA()
+
+			if (r == 0) != black[[2]int{x, y}] {
+				t.Errorf("Wrong colour for pixel %d,%d", x, y)
+			}
+		}
+	}
+}
@@ -0,0 +1,105 @@
+package components
+
+import (
+	"bufio"
+	"encoding/binary"
+	"io"
+)
+
+// TraceRecord is what happened during a single cycle; the instruction
+// executed (and where from), the registers after it executed and any
+// write to RAM.
+type TraceRecord struct {
+	PC          uint16
+	Instruction uint16
+	A           int16
+	D           int16
+	Wrote       bool
+	Address     uint16 // only meaningful if Wrote
+	Value       int16  // only meaningful if Wrote
+}
+
+// On disk each record is six little endian 16 bit words; PC,
+// instruction, A, D, address and value, with an address of 0xFFFF
+// (outside of RAM) meaning there was no write.
+const traceRecordSize = 12
+const traceNoWrite = 0xFFFF
+
+// TraceWriter writes trace records in the compact binary format.
+type TraceWriter struct {
+	out *bufio.Writer
+	buf [traceRecordSize]byte
+	err error
+}
+
+// NewTraceWriter returns a writer for w.  Use it with Observe, and
+// call Flush once done.
+func NewTraceWriter(w io.Writer) *TraceWriter {
+	return &TraceWriter{out: bufio.NewWriter(w)}
+}
+
+// Record writes a single record.  Any error is held on to and returned
+// by Flush.
+func (t *TraceWriter) Record(r TraceRecord) {
+	if t.err != nil {
+		return
+	}
+
+	addr, value := uint16(traceNoWrite), r.Value
+
+	if r.Wrote {
+		addr = r.Address
+	} else {
+		value = 0
+	}
+
+	le := binary.LittleEndian
+	le.PutUint16(t.buf[0:], r.PC)
+	le.PutUint16(t.buf[2:], r.Instruction)
+	le.PutUint16(t.buf[4:], uint16(r.A))
+	le.PutUint16(t.buf[6:], uint16(r.D))
+	le.PutUint16(t.buf[8:], addr)
+	le.PutUint16(t.buf[10:], uint16(value))
+
+	_, t.err = t.out.Write(t.buf[:])
+}
+
+// Flush writes out anything buffered, returning the first error seen.
+func (t *TraceWriter) Flush() error {
+	if t.err != nil {
+		return t.err
+	}
+
+	return t.out.Flush()
+}
+
+// ReadTrace reads records written by a TraceWriter, calling f for each
+// one.
+func ReadTrace(r io.Reader, f func(TraceRecord)) error {
+	in := bufio.NewReader(r)
+	var buf [traceRecordSize]byte
+	le := binary.LittleEndian
+
+	for {
+		if _, err := io.ReadFull(in, buf[:]); err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+
+		rec := TraceRecord{
+			PC:          le.Uint16(buf[0:]),
+			Instruction: le.Uint16(buf[2:]),
+			A:           int16(le.Uint16(buf[4:])),
+			D:           int16(le.Uint16(buf[6:])),
+		}
+
+		if addr := le.Uint16(buf[8:]); addr != traceNoWrite {
+			rec.Wrote = true
+			rec.Address = addr
+			rec.Value = int16(le.Uint16(buf[10:]))
+		}
+
+		f(rec)
+	}
+}
@@ -0,0 +1,114 @@
+package components
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestTraceRoundTrip(t *testing.T) {
+	prog, err := AssembleProgram(sumSource)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c := NewHackComputer()
+	c.LoadProgram(prog)
+	c.RAM[0] = 3
+
+	var buf bytes.Buffer
+	var written []TraceRecord
+	tw := NewTraceWriter(&buf)
+
+	c.Observe(tw.Record)
+	c.Observe(func(r TraceRecord) { written = append(written, r) })
+	c.Run(1000)
+
+	if err := tw.Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	if buf.Len() != len(written)*traceRecordSize {
+		t.Errorf("Expected %d bytes of trace, got %d", len(written)*traceRecordSize, buf.Len())
+	}
+
+	var read []TraceRecord
+
+	if err := ReadTrace(&buf, func(r TraceRecord) { read = append(read, r) }); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(read) != len(written) {
+		t.Fatalf("Wrote %d records, read %d", len(written), len(read))
+	}
+
+	for i := range read {
+		w := written[i]
+
+		if !w.Wrote {
+			w.Address, w.Value = 0, 0
+		}
+
+		if read[i] != w {
+			t.Errorf("Record %d: wrote %+v, read %+v", i, w, read[i])
+		}
+	}
+
+	// the last write should be the result into R1
+	last := TraceRecord{}
+
+	for _, r := range read {
+		if r.Wrote {
+			last = r
+		}
+	}
+
+	if last.Address != 1 || last.Value != 6 {
+		t.Errorf("Expected the last write to be 6 into R1, got %d into %d", last.Value, last.Address)
+	}
+}
+
+func TestProfiler(t *testing.T) {
+	prog, err := AssembleProgram(sumSource)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c := NewHackComputer()
+	c.LoadProgram(prog)
+	c.RAM[0] = 10
+
+	p := NewProfiler(prog)
+	c.Observe(p.Record)
+	n := c.Run(10000)
+
+	labels := p.Labels(0)
+
+	if len(labels) == 0 || labels[0].Name != "LOOP" {
+		t.Fatalf("Expected LOOP to be the hottest label, got %+v", labels)
+	}
+
+	total := 0
+
+	for _, l := range labels {
+		total += l.Cycles
+	}
+
+	if total != n {
+		t.Errorf("Expected label ranges to add up to %d cycles, got %d", n, total)
+	}
+
+	// the top of the loop is run once more than the rest of it
+	if top := p.Addresses(1); top[0].Start != prog.Labels["LOOP"] || top[0].Cycles != 11 {
+		t.Errorf("Expected 11 cycles at LOOP, got %+v", top[0])
+	}
+
+	var report bytes.Buffer
+	p.WriteReport(&report, 5)
+
+	if !strings.Contains(report.String(), "LOOP") {
+		t.Errorf("Expected LOOP in the report, got:\n%s", report.String())
+	}
+}
@@ -0,0 +1,451 @@
+/*
+ Parser for the course's hardware description language (HDL), e.g.
+
+   CHIP And {
+       IN a, b;
+       OUT out;
+       PARTS:
+       Nand(a=a, b=b, out=x);
+       Not(in=x, out=out);
+   }
+
+ Unlike the assembler this doesn't bother with a lexer running in its
+ own goroutine, the language is small enough that a tokeniser and a
+ recursive descent parser will do.
+*/
+
+package components
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+type hdlChip struct {
+	name    string
+	inputs  []hdlPin
+	outputs []hdlPin
+	parts   []hdlPart
+	builtin string   // name of the built-in implementation, if any
+	clocked []string // pins named by a CLOCKED clause
+}
+
+type hdlPin struct {
+	name  string
+	width int
+}
+
+type hdlPart struct {
+	chip        string
+	connections []hdlConnection
+	lineNum     int
+}
+
+// A connection from a pin on a part (inner) to a pin on the chip
+// being defined (outer), e.g. a[0..7]=x
+type hdlConnection struct {
+	inner hdlPinRef
+	outer hdlPinRef
+}
+
+// A reference to a pin, optionally sub-bussed; a[3] or a[0..7].
+type hdlPinRef struct {
+	name    string
+	subBus  bool
+	low     int
+	high    int
+	lineNum int
+}
+
+func (r hdlPinRef) String() string {
+	if !r.subBus {
+		return r.name
+	}
+
+	if r.low == r.high {
+		return fmt.Sprintf("%s[%d]", r.name, r.low)
+	}
+
+	return fmt.Sprintf("%s[%d..%d]", r.name, r.low, r.high)
+}
+
+func (c *hdlChip) input(name string) (hdlPin, bool) {
+	return findPin(c.inputs, name)
+}
+
+func (c *hdlChip) output(name string) (hdlPin, bool) {
+	return findPin(c.outputs, name)
+}
+
+func findPin(pins []hdlPin, name string) (hdlPin, bool) {
+	for _, p := range pins {
+		if p.name == name {
+			return p, true
+		}
+	}
+
+	return hdlPin{}, false
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// Tokeniser
+////////////////////////////////////////////////////////////////////////////////
+
+type hdlToken struct {
+	value   string
+	lineNum int
+}
+
+const hdlSymbols = "{}()[],;=:"
+
+func tokeniseHdl(source string) ([]hdlToken, error) {
+	var tokens []hdlToken
+	lineNum := 1
+	i := 0
+
+	for i < len(source) {
+		c := source[i]
+
+		switch {
+		case c == '\n':
+			lineNum++
+			i++
+
+		case unicode.IsSpace(rune(c)):
+			i++
+
+		case strings.HasPrefix(source[i:], "//"):
+			end := strings.IndexByte(source[i:], '\n')
+			if end == -1 {
+				end = len(source) - i
+			}
+			i += end
+
+		case strings.HasPrefix(source[i:], "/*"):
+			end := strings.Index(source[i:], "*/")
+			if end == -1 {
+				return nil, fmt.Errorf("Unterminated comment, line %d", lineNum)
+			}
+			lineNum += strings.Count(source[i:i+end], "\n")
+			i += end + 2
+
+		case strings.HasPrefix(source[i:], ".."):
+			tokens = append(tokens, hdlToken{"..", lineNum})
+			i += 2
+
+		case strings.IndexByte(hdlSymbols, c) != -1:
+			tokens = append(tokens, hdlToken{string(c), lineNum})
+			i++
+
+		case isHdlIdentifier(c):
+			start := i
+			for i < len(source) && isHdlIdentifier(source[i]) {
+				i++
+			}
+			tokens = append(tokens, hdlToken{source[start:i], lineNum})
+
+		default:
+			return nil, fmt.Errorf("Unexpected character %q, line %d", c, lineNum)
+		}
+	}
+
+	return tokens, nil
+}
+
+func isHdlIdentifier(c byte) bool {
+	return c == '_' ||
+		(c >= 'a' && c <= 'z') ||
+		(c >= 'A' && c <= 'Z') ||
+		(c >= '0' && c <= '9')
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// Parser
+////////////////////////////////////////////////////////////////////////////////
+
+type hdlParser struct {
+	tokens []hdlToken
+	pos    int
+}
+
+func parseHdl(source string) (*hdlChip, error) {
+	tokens, err := tokeniseHdl(source)
+
+	if err != nil {
+		return nil, err
+	}
+
+	p := hdlParser{tokens: tokens}
+
+	return p.chip()
+}
+
+// Returns the current token, or an empty one at EOF.
+func (p *hdlParser) peek() hdlToken {
+	if p.pos >= len(p.tokens) {
+		line := 0
+		if len(p.tokens) > 0 {
+			line = p.tokens[len(p.tokens)-1].lineNum
+		}
+		return hdlToken{"", line}
+	}
+
+	return p.tokens[p.pos]
+}
+
+func (p *hdlParser) next() hdlToken {
+	t := p.peek()
+	p.pos++
+
+	return t
+}
+
+func (p *hdlParser) expect(value string) error {
+	t := p.next()
+
+	if t.value != value {
+		return p.unexpected(t, "'"+value+"'")
+	}
+
+	return nil
+}
+
+func (p *hdlParser) identifier() (hdlToken, error) {
+	t := p.next()
+
+	if t.value == "" || strings.IndexByte(hdlSymbols, t.value[0]) != -1 || t.value == ".." {
+		return t, p.unexpected(t, "a name")
+	}
+
+	return t, nil
+}
+
+func (p *hdlParser) number() (int, error) {
+	t := p.next()
+	n, err := strconv.Atoi(t.value)
+
+	if err != nil || n < 0 {
+		return 0, p.unexpected(t, "a number")
+	}
+
+	return n, nil
+}
+
+func (p *hdlParser) unexpected(t hdlToken, expected string) error {
+	found := "end of file"
+
+	if t.value != "" {
+		found = "'" + t.value + "'"
+	}
+
+	return fmt.Errorf("Expected %s but found %s, line %d", expected, found, t.lineNum)
+}
+
+func (p *hdlParser) chip() (*hdlChip, error) {
+	if err := p.expect("CHIP"); err != nil {
+		return nil, err
+	}
+
+	name, err := p.identifier()
+
+	if err != nil {
+		return nil, err
+	}
+
+	chip := hdlChip{name: name.value}
+
+	if err := p.expect("{"); err != nil {
+		return nil, err
+	}
+
+	for {
+		t := p.next()
+
+		switch t.value {
+		case "IN":
+			chip.inputs, err = p.pinList()
+
+		case "OUT":
+			chip.outputs, err = p.pinList()
+
+		case "PARTS":
+			if err = p.expect(":"); err == nil {
+				chip.parts, err = p.parts()
+			}
+
+		case "BUILTIN":
+			var b hdlToken
+			if b, err = p.identifier(); err == nil {
+				chip.builtin = b.value
+				err = p.expect(";")
+			}
+
+		case "CLOCKED":
+			chip.clocked, err = p.nameList()
+
+		case "}":
+			if p.pos < len(p.tokens) {
+				return nil, p.unexpected(p.peek(), "end of file")
+			}
+			return &chip, nil
+
+		default:
+			return nil, p.unexpected(t, "IN, OUT, PARTS, BUILTIN, CLOCKED or '}'")
+		}
+
+		if err != nil {
+			return nil, err
+		}
+	}
+}
+
+// a, b[16], c;
+func (p *hdlParser) pinList() ([]hdlPin, error) {
+	var pins []hdlPin
+
+	for {
+		name, err := p.identifier()
+
+		if err != nil {
+			return nil, err
+		}
+
+		pin := hdlPin{name: name.value, width: 1}
+
+		if p.peek().value == "[" {
+			p.next()
+
+			if pin.width, err = p.number(); err != nil {
+				return nil, err
+			}
+
+			if pin.width < 1 || pin.width > 16 {
+				return nil, fmt.Errorf("Invalid width for pin %s, line %d", pin.name, name.lineNum)
+			}
+
+			if err := p.expect("]"); err != nil {
+				return nil, err
+			}
+		}
+
+		pins = append(pins, pin)
+
+		if t := p.next(); t.value == ";" {
+			return pins, nil
+		} else if t.value != "," {
+			return nil, p.unexpected(t, "',' or ';'")
+		}
+	}
+}
+
+// a, b;
+func (p *hdlParser) nameList() ([]string, error) {
+	var names []string
+
+	for {
+		name, err := p.identifier()
+
+		if err != nil {
+			return nil, err
+		}
+
+		names = append(names, name.value)
+
+		if t := p.next(); t.value == ";" {
+			return names, nil
+		} else if t.value != "," {
+			return nil, p.unexpected(t, "',' or ';'")
+		}
+	}
+}
+
+// Part(a=x, b=y); ... until the closing brace of the chip.
+func (p *hdlParser) parts() ([]hdlPart, error) {
+	var parts []hdlPart
+
+	for p.peek().value != "}" && p.peek().value != "" {
+		name, err := p.identifier()
+
+		if err != nil {
+			return nil, err
+		}
+
+		part := hdlPart{chip: name.value, lineNum: name.lineNum}
+
+		if err := p.expect("("); err != nil {
+			return nil, err
+		}
+
+		for {
+			var c hdlConnection
+
+			if c.inner, err = p.pinRef(); err != nil {
+				return nil, err
+			}
+
+			if err := p.expect("="); err != nil {
+				return nil, err
+			}
+
+			if c.outer, err = p.pinRef(); err != nil {
+				return nil, err
+			}
+
+			part.connections = append(part.connections, c)
+
+			if t := p.next(); t.value == ")" {
+				break
+			} else if t.value != "," {
+				return nil, p.unexpected(t, "',' or ')'")
+			}
+		}
+
+		if err := p.expect(";"); err != nil {
+			return nil, err
+		}
+
+		parts = append(parts, part)
+	}
+
+	return parts, nil
+}
+
+// a, a[3] or a[0..7]
+func (p *hdlParser) pinRef() (hdlPinRef, error) {
+	name, err := p.identifier()
+
+	if err != nil {
+		return hdlPinRef{}, err
+	}
+
+	ref := hdlPinRef{name: name.value, lineNum: name.lineNum}
+
+	if p.peek().value != "[" {
+		return ref, nil
+	}
+
+	p.next()
+	ref.subBus = true
+
+	if ref.low, err = p.number(); err != nil {
+		return ref, err
+	}
+
+	ref.high = ref.low
+
+	if p.peek().value == ".." {
+		p.next()
+
+		if ref.high, err = p.number(); err != nil {
+			return ref, err
+		}
+	}
+
+	if ref.high < ref.low {
+		return ref, fmt.Errorf("Invalid sub bus %s, line %d", ref, name.lineNum)
+	}
+
+	return ref, p.expect("]")
+}
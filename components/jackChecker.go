@@ -0,0 +1,357 @@
+/*
+ Semantic checks on Jack programs, for the mistakes the course's
+ compiler lets through:
+
+   - variables that aren't declared (or fields used from a function)
+   - calls to subroutines that don't exist, or with the wrong number of
+     arguments, where the class is known (part of the program, or the OS)
+   - calling a method without an object, e.g. from a function, or calling
+     a function or constructor on an object
+   - returning a value from a void subroutine, or not from anything else
+   - a subroutine that can run off its end without returning
+   - assigning to something other than a variable or array element
+   - using the value of a void subroutine
+
+ Classes that aren't in the program (other than the OS) aren't known,
+ so calls to them aren't checked.
+*/
+
+package components
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+type jackSignature struct {
+	kind string // constructor, function or method
+	typ  string // what it returns, or void
+	args int    // not counting this
+}
+
+// The OS's API, used for the OS classes the program doesn't define.
+var jackOSSignatures = map[string]jackSignature{
+	"Math.init":     {"function", "void", 0},
+	"Math.abs":      {"function", "int", 1},
+	"Math.multiply": {"function", "int", 2},
+	"Math.divide":   {"function", "int", 2},
+	"Math.min":      {"function", "int", 2},
+	"Math.max":      {"function", "int", 2},
+	"Math.sqrt":     {"function", "int", 1},
+
+	"Memory.init":    {"function", "void", 0},
+	"Memory.peek":    {"function", "int", 1},
+	"Memory.poke":    {"function", "void", 2},
+	"Memory.alloc":   {"function", "int", 1},
+	"Memory.deAlloc": {"function", "void", 1},
+
+	"Array.new":     {"function", "Array", 1},
+	"Array.dispose": {"method", "void", 0},
+
+	"String.new":           {"constructor", "String", 1},
+	"String.dispose":       {"method", "void", 0},
+	"String.length":        {"method", "int", 0},
+	"String.charAt":        {"method", "char", 1},
+	"String.setCharAt":     {"method", "void", 2},
+	"String.appendChar":    {"method", "String", 1},
+	"String.eraseLastChar": {"method", "void", 0},
+	"String.intValue":      {"method", "int", 0},
+	"String.setInt":        {"method", "void", 1},
+	"String.backSpace":     {"function", "char", 0},
+	"String.doubleQuote":   {"function", "char", 0},
+	"String.newLine":       {"function", "char", 0},
+
+	"Output.init":        {"function", "void", 0},
+	"Output.moveCursor":  {"function", "void", 2},
+	"Output.printChar":   {"function", "void", 1},
+	"Output.printString": {"function", "void", 1},
+	"Output.printInt":    {"function", "void", 1},
+	"Output.println":     {"function", "void", 0},
+	"Output.backSpace":   {"function", "void", 0},
+
+	"Screen.init":          {"function", "void", 0},
+	"Screen.clearScreen":   {"function", "void", 0},
+	"Screen.setColor":      {"function", "void", 1},
+	"Screen.drawPixel":     {"function", "void", 2},
+	"Screen.drawLine":      {"function", "void", 4},
+	"Screen.drawRectangle": {"function", "void", 4},
+	"Screen.drawCircle":    {"function", "void", 3},
+
+	"Keyboard.init":       {"function", "void", 0},
+	"Keyboard.keyPressed": {"function", "char", 0},
+	"Keyboard.readChar":   {"function", "char", 0},
+	"Keyboard.readLine":   {"function", "String", 1},
+	"Keyboard.readInt":    {"function", "int", 1},
+
+	"Sys.init":  {"function", "void", 0},
+	"Sys.halt":  {"function", "void", 0},
+	"Sys.error": {"function", "void", 1},
+	"Sys.wait":  {"function", "void", 1},
+}
+
+var jackOSClasses = map[string]bool{
+	"Math": true, "Memory": true, "Array": true, "String": true,
+	"Output": true, "Screen": true, "Keyboard": true, "Sys": true,
+}
+
+var jackPrimitives = map[string]bool{"int": true, "char": true, "boolean": true}
+
+type jackVariable struct {
+	kind string // static, field, argument or var
+	typ  string
+}
+
+type jackChecker struct {
+	program     *JackProgram
+	class       *jackClass
+	sub         *jackSubroutine
+	classVars   map[string]jackVariable
+	locals      map[string]jackVariable
+	diagnostics []JackDiagnostic
+}
+
+// Check returns the program's semantic errors, in the order they
+// appear in each file.
+func (p *JackProgram) Check() []JackDiagnostic {
+	c := jackChecker{program: p}
+	defined := make(map[string]bool)
+
+	for _, class := range p.classes {
+		c.class = class
+
+		if defined[class.Name] {
+			c.report(class.Pos, "Class %s is defined more than once", class.Name)
+		}
+
+		defined[class.Name] = true
+
+		if file := strings.TrimSuffix(filepath.Base(class.file), filepath.Ext(class.file)); file != class.Name {
+			c.report(class.Pos, "Class %s should be in %s.jack, not %s.jack", class.Name, class.Name, file)
+		}
+
+		c.checkClass()
+	}
+
+	return c.diagnostics
+}
+
+func (c *jackChecker) report(pos jackPos, format string, args ...interface{}) {
+	c.diagnostics = append(c.diagnostics, JackDiagnostic{c.class.file, pos.Line, pos.Column, fmt.Sprintf(format, args...)})
+}
+
+// Names are added to scope, reporting any declared twice.
+func (c *jackChecker) declare(scope map[string]jackVariable, decs []jackVarDec) {
+	for _, dec := range decs {
+		for _, n := range dec.Names {
+			if _, dupe := scope[n.Name]; dupe {
+				c.report(n.Pos, "%s is already declared", n.Name)
+			}
+
+			scope[n.Name] = jackVariable{dec.Kind, dec.Type}
+		}
+	}
+}
+
+func (c *jackChecker) checkClass() {
+	c.classVars = make(map[string]jackVariable)
+	c.declare(c.classVars, c.class.Vars)
+
+	subs := make(map[string]bool)
+
+	for i := range c.class.Subroutines {
+		c.sub = &c.class.Subroutines[i]
+
+		if subs[c.sub.Name] {
+			c.report(c.sub.Pos, "Subroutine %s is defined more than once", c.sub.Name)
+		}
+
+		subs[c.sub.Name] = true
+
+		c.locals = make(map[string]jackVariable)
+		c.declare(c.locals, c.sub.Params)
+		c.declare(c.locals, c.sub.Locals)
+		c.checkStatements(c.sub.Body)
+
+		if !jackReturns(c.sub.Body) {
+			c.report(c.sub.End, "Missing return at the end of %s", c.sub.Name)
+		}
+	}
+}
+
+// True if the statements always end with a return.
+func jackReturns(statements []jackStatement) bool {
+	for _, s := range statements {
+		switch {
+		case s.Kind == "return":
+			return true
+		case s.Kind == "if" && s.HasElse && jackReturns(s.Body) && jackReturns(s.Else):
+			return true
+		}
+	}
+
+	return false
+}
+
+func (c *jackChecker) checkStatements(statements []jackStatement) {
+	for _, s := range statements {
+		switch s.Kind {
+		case "let":
+			if s.Target.Kind != "var" && s.Target.Kind != "index" {
+				c.report(s.Target.Pos, "Can only assign to a variable or an array element")
+			}
+
+			c.checkExpr(s.Target)
+			c.checkValue(s.Value)
+
+		case "if", "while":
+			c.checkValue(s.Value)
+			c.checkStatements(s.Body)
+			c.checkStatements(s.Else)
+
+		case "do":
+			c.checkExpr(s.Value)
+
+		case "return":
+			switch {
+			case c.sub.Type == "void" && s.Value != nil:
+				c.report(s.Pos, "%s is void, so can't return a value", c.sub.Name)
+			case c.sub.Type != "void" && s.Value == nil:
+				c.report(s.Pos, "%s must return a value", c.sub.Name)
+			}
+
+			if s.Value != nil {
+				c.checkValue(s.Value)
+			}
+		}
+	}
+}
+
+// Checks an expression whose value is used.
+func (c *jackChecker) checkValue(e *jackExpr) {
+	c.checkExpr(e)
+
+	if e.Kind == "call" {
+		if class, sig, ok := c.signature(e); ok && sig.typ == "void" {
+			c.report(e.Pos, "%s.%s is void, so has no value", class, e.Value)
+		}
+	}
+}
+
+func (c *jackChecker) checkExpr(e *jackExpr) {
+	switch e.Kind {
+	case "var", "index":
+		if _, ok := c.variable(e.Value, e.Pos); !ok {
+			c.report(e.Pos, "Undeclared variable %s", e.Value)
+		}
+
+	case "keyword":
+		if e.Value == "this" && c.sub.Kind == "function" {
+			c.report(e.Pos, "Can't use this in a function")
+		}
+
+	case "call":
+		c.checkCall(e)
+	}
+
+	for _, o := range e.Operands {
+		c.checkValue(o)
+	}
+}
+
+// Looks up a variable, reporting any use of a field from a function.
+func (c *jackChecker) variable(name string, pos jackPos) (jackVariable, bool) {
+	v, ok := c.lookup(name)
+
+	if ok && v.kind == "field" && c.sub.Kind == "function" {
+		c.report(pos, "Can't use field %s in a function", name)
+	}
+
+	return v, ok
+}
+
+func (c *jackChecker) lookup(name string) (jackVariable, bool) {
+	if v, ok := c.locals[name]; ok {
+		return v, true
+	}
+
+	v, ok := c.classVars[name]
+
+	return v, ok
+}
+
+func (c *jackChecker) checkCall(e *jackExpr) {
+	_, onObject := c.lookup(e.Object)
+
+	if onObject {
+		if v, _ := c.variable(e.Object, e.Pos); jackPrimitives[v.typ] {
+			c.report(e.Pos, "Can't call %s on %s, its type is %s", e.Value, e.Object, v.typ)
+			return
+		}
+	}
+
+	class, sig, ok := c.signature(e)
+
+	switch {
+	case !ok && c.classKnown(class):
+		c.report(e.Pos, "%s has no subroutine %s", class, e.Value)
+		return
+
+	case !ok:
+		return
+
+	case sig.kind == "method" && e.Object != "" && !onObject:
+		c.report(e.Pos, "%s.%s is a method, so needs an object", class, e.Value)
+
+	case sig.kind == "method" && e.Object == "" && c.sub.Kind == "function":
+		c.report(e.Pos, "Can't call method %s from function %s without an object", e.Value, c.sub.Name)
+
+	case sig.kind != "method" && onObject:
+		c.report(e.Pos, "%s.%s is a %s, so is called on the class rather than an object", class, e.Value, sig.kind)
+	}
+
+	if len(e.Operands) != sig.args {
+		c.report(e.Pos, "%s.%s expects %d arguments, given %d", class, e.Value, sig.args, len(e.Operands))
+	}
+}
+
+// The class a call is to, and the signature of what's called if the
+// class is known and has it.
+func (c *jackChecker) signature(e *jackExpr) (string, jackSignature, bool) {
+	class := e.Object
+
+	if v, ok := c.lookup(class); ok {
+		class = v.typ
+	} else if class == "" {
+		class = c.class.Name
+	}
+
+	for _, cl := range c.program.classes {
+		if cl.Name != class {
+			continue
+		}
+
+		for _, sub := range cl.Subroutines {
+			if sub.Name == e.Value {
+				return class, jackSignature{sub.Kind, sub.Type, len(sub.Params)}, true
+			}
+		}
+
+		return class, jackSignature{}, false
+	}
+
+	sig, ok := jackOSSignatures[class+"."+e.Value]
+
+	return class, sig, ok
+}
+
+// Classes in the program, or the OS.
+func (c *jackChecker) classKnown(name string) bool {
+	for _, cl := range c.program.classes {
+		if cl.Name == name {
+			return true
+		}
+	}
+
+	return jackOSClasses[name]
+}
@@ -0,0 +1,148 @@
+package components
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestJackCheckClean(t *testing.T) {
+	prog, err := LoadJackProgram("testdata/jack/ArrayTest")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if diags := prog.Check(); len(diags) != 0 {
+		t.Errorf("Expected no diagnostics, got %v", diags)
+	}
+}
+
+// Each line of the bad program that's wrong is followed by the
+// diagnostic expected for it.
+const badJackProgram = `class Main {
+  field int count;
+  static Point origin;
+
+  function void main() {
+    var int x, x;
+// Main.jack:6:16: x is already declared
+    var Point p;
+    let y = 1;
+// Main.jack:9:9: Undeclared variable y
+    let count = 1;
+// Main.jack:11:9: Can't use field count in a function
+    let Main.main() = 2;
+// Main.jack:13:9: Can only assign to a variable or an array element
+    do draw();
+// Main.jack:15:8: Can't call method draw from function main without an object
+    do Point.move(1);
+// Main.jack:17:8: Point.move is a method, so needs an object
+    do p.new(1, 2);
+// Main.jack:19:8: Point.new is a constructor, so is called on the class rather than an object
+    do p.move(1, 2);
+// Main.jack:21:8: Point.move expects 1 arguments, given 2
+    do Output.printInt();
+// Main.jack:23:8: Output.printInt expects 1 arguments, given 0
+    do Math.cube(x);
+// Main.jack:25:8: Math has no subroutine cube
+    do x.foo();
+// Main.jack:27:8: Can't call foo on x, its type is int
+    let x = Output.println();
+// Main.jack:29:13: Output.println is void, so has no value
+    let x = this;
+// Main.jack:31:13: Can't use this in a function
+    do Elsewhere.anything(1, 2, 3);
+    return 1;
+// Main.jack:34:5: main is void, so can't return a value
+  }
+
+  method void draw() {
+    if (count > 0) {
+      return;
+    }
+  }
+// Main.jack:42:3: Missing return at the end of draw
+
+  method int size() {
+    if (count > 0) {
+      return count;
+    } else {
+      return;
+// Main.jack:49:7: size must return a value
+    }
+  }
+}`
+
+const pointClass = `class Point {
+  constructor Point new(int x, int y) { return this; }
+  method void move(int dx) { return; }
+}`
+
+func TestJackCheck(t *testing.T) {
+	var expected []string
+
+	for _, line := range strings.Split(badJackProgram, "\n") {
+		if strings.HasPrefix(line, "// ") {
+			expected = append(expected, line[3:])
+		}
+	}
+
+	prog, err := ParseJack([]string{"Main.jack", "Point.jack"}, map[string]string{"Main.jack": badJackProgram, "Point.jack": pointClass})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	diags := prog.Check()
+
+	for i := 0; i < max(len(diags), len(expected)); i++ {
+		switch {
+		case i >= len(diags):
+			t.Errorf("Missing %q", expected[i])
+		case i >= len(expected):
+			t.Errorf("Unexpected %q", diags[i])
+		case diags[i].Error() != expected[i]:
+			t.Errorf("Expected %q, got %q", expected[i], diags[i])
+		}
+	}
+}
+
+func TestJackCheckFiles(t *testing.T) {
+	prog, err := ParseJack([]string{"dir/Main.jack", "dir/Other.jack"}, map[string]string{
+		"dir/Main.jack":  "class Main { function void main() { return; } }",
+		"dir/Other.jack": "class Main { }",
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	diags := prog.Check()
+
+	if len(diags) != 2 ||
+		diags[0].Error() != "dir/Other.jack:1:7: Class Main is defined more than once" ||
+		diags[1].Error() != "dir/Other.jack:1:7: Class Main should be in Main.jack, not Other.jack" {
+		t.Errorf("Unexpected diagnostics: %v", diags)
+	}
+}
+
+// The checker's idea of the OS is the same as the built in OS's.
+func TestJackOSSignatures(t *testing.T) {
+	for name, sig := range jackOSSignatures {
+		args := sig.args
+
+		if sig.kind == "method" {
+			args++
+		}
+
+		if f, ok := jackFunctions[name]; ok && f.args != args {
+			t.Errorf("%s: checked for %d arguments, the OS takes %d", name, args, f.args)
+		}
+	}
+
+	for name := range jackFunctions {
+		if _, ok := jackOSSignatures[name]; !ok {
+			t.Errorf("%s isn't checked", name)
+		}
+	}
+}
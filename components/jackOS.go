@@ -0,0 +1,889 @@
+/*
+ The Jack OS (Math, String, Array, Output, Screen, Keyboard, Memory
+ and Sys) written in Go, so that compiled Jack programs can be run by
+ the VM interpreter without the OS's own .vm files.  Any OS function a
+ program does define (i.e. if the OS .vm files are loaded along with
+ it) is used instead.  Where a built in function uses another OS class
+ (Array.new allocating with Memory.alloc, Output.printString reading
+ a string with String.length and String.charAt, and so on) it calls
+ the program's version if there is one, so the OS can be replaced a
+ class at a time, as project 12 does.  Calls within a class are made
+ directly, so a class is best replaced as a whole.
+
+ Output is kept as 23 rows of 64 characters rather than being drawn
+ into screen memory, and is also written to the console's writer as
+ it happens.  Keyboard reads come from the console's reader, so that
+ programs can be run headlessly with their input piped in.
+*/
+
+package components
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"strconv"
+	"strings"
+)
+
+const outputRows = 23
+const outputColumns = 64
+const heapEnd = screenBase // the heap is vmHeap up to here
+const jackLineLength = 64  // longest line Keyboard.readLine reads
+const jackNewline = 128    // Keyboard.newLine etc
+const jackBackspace = 129  // Keyboard.backSpace etc
+const jackDoubleQuote = 34 // String.doubleQuote
+const jackMaxRadius = 181  // Screen.drawCircle
+const jackStringHeader = 2 // max length and length, before the characters
+
+// Sys.error codes, as used by the course's OS.
+var jackErrors = map[int16]string{
+	1:  "Duration must be positive",
+	2:  "Array size must be positive",
+	3:  "Division by zero",
+	4:  "Cannot compute square root of a negative number",
+	5:  "Allocated memory size must be positive",
+	6:  "Heap overflow",
+	7:  "Illegal pixel coordinates",
+	8:  "Illegal line coordinates",
+	9:  "Illegal rectangle coordinates",
+	12: "Illegal center coordinates",
+	13: "Illegal radius",
+	14: "Maximum length must be non-negative",
+	15: "String index out of bounds",
+	16: "String index out of bounds",
+	17: "String is full",
+	18: "String is empty",
+	19: "Insufficient string capacity",
+	20: "Illegal cursor location",
+}
+
+type jackError int16
+
+func (e jackError) Error() string {
+	return fmt.Sprintf("Sys.error(%d): %s", int16(e), jackErrors[int16(e)])
+}
+
+type heapBlock struct {
+	addr int
+	size int
+}
+
+type jackOS struct {
+	vm        *VMachine
+	free      []heapBlock // in address order
+	allocated map[int]int // address to size
+	black     bool        // Screen.setColor
+	text      [outputRows][outputColumns]byte
+	row, col  int
+	in        *bufio.Reader
+	out       io.Writer
+
+	// jackFunctions, which can't be used directly by anything the
+	// functions themselves call
+	builtins map[string]jackFunction
+}
+
+type jackFunction struct {
+	args int
+	f    func(jos *jackOS, args []int16) (int16, error)
+}
+
+func newJackOS(vm *VMachine) *jackOS {
+	jos := jackOS{
+		vm:        vm,
+		builtins:  jackFunctions,
+		free:      []heapBlock{{vmHeap, heapEnd - vmHeap}},
+		allocated: make(map[int]int),
+		black:     true,
+		out:       ioutil.Discard,
+	}
+
+	jos.clearText()
+
+	return &jos
+}
+
+// SetConsole sets where the built in OS's Keyboard reads from and
+// where its Output writes to.  By default there's no input and output
+// is only kept as text, see Console.
+func (vm *VMachine) SetConsole(in io.Reader, out io.Writer) {
+	vm.jos.in = bufio.NewReader(in)
+	vm.jos.out = out
+}
+
+// Console returns the text written by the built in OS's Output, one
+// string per row with trailing spaces removed.
+func (vm *VMachine) Console() []string {
+	rows := make([]string, outputRows)
+
+	for i, r := range vm.jos.text {
+		rows[i] = strings.TrimRight(string(r[:]), " ")
+	}
+
+	return rows
+}
+
+// Pops the arguments, calls the function and pushes its result, so
+// that to the caller it looks the same as a call to VM code.
+func (jos *jackOS) call(name string, args int) error {
+	f, ok := jos.builtins[name]
+
+	if !ok {
+		return fmt.Errorf("Function %s is not defined", name)
+	}
+
+	if args != f.args {
+		return fmt.Errorf("%s expects %d arguments, called with %d", name, f.args, args)
+	}
+
+	values := make([]int16, args)
+
+	for i := args - 1; i >= 0; i-- {
+		values[i] = jos.vm.pop()
+	}
+
+	result, err := f.f(jos, values)
+
+	if err != nil {
+		return err
+	}
+
+	jos.vm.push(result)
+
+	return nil
+}
+
+// Commands a program's OS function can take when invoked by a built in
+// one, before it's assumed it'll never return.
+const jackMaxInvoke = 10000000
+
+// Calls an OS function on behalf of a built in one; the program's own
+// if it defines it, running it until it returns, otherwise the built
+// in one.
+func (jos *jackOS) invoke(name string, args ...int16) (int16, error) {
+	vm := jos.vm
+
+	if _, ok := vm.program.functions[name]; !ok {
+		return jos.builtins[name].f(jos, args)
+	}
+
+	depth, pc := len(vm.callStack), vm.PC
+
+	for _, a := range args {
+		vm.push(a)
+	}
+
+	if err := vm.call(name, len(args), pc); err != nil {
+		return 0, err
+	}
+
+	for n := 0; len(vm.callStack) > depth; n++ {
+		switch {
+		case vm.err != nil:
+			return 0, vm.err
+		case vm.Halted() || n == jackMaxInvoke:
+			return 0, fmt.Errorf("%s didn't return", name)
+		}
+
+		vm.Step()
+	}
+
+	vm.PC = pc
+
+	return vm.pop(), nil
+}
+
+var jackFunctions = map[string]jackFunction{
+	"Math.init":     {0, osNothing},
+	"Math.abs":      {1, mathAbs},
+	"Math.multiply": {2, mathMultiply},
+	"Math.divide":   {2, mathDivide},
+	"Math.min":      {2, mathMin},
+	"Math.max":      {2, mathMax},
+	"Math.sqrt":     {1, mathSqrt},
+
+	"Memory.init":    {0, osNothing},
+	"Memory.peek":    {1, memoryPeek},
+	"Memory.poke":    {2, memoryPoke},
+	"Memory.alloc":   {1, memoryAlloc},
+	"Memory.deAlloc": {1, memoryDeAlloc},
+
+	"Array.new":     {1, arrayNew},
+	"Array.dispose": {1, osDispose},
+
+	"String.new":           {1, stringNew},
+	"String.dispose":       {1, osDispose},
+	"String.length":        {1, stringLength},
+	"String.charAt":        {2, stringCharAt},
+	"String.setCharAt":     {3, stringSetCharAt},
+	"String.appendChar":    {2, stringAppendChar},
+	"String.eraseLastChar": {1, stringEraseLastChar},
+	"String.intValue":      {1, stringIntValue},
+	"String.setInt":        {2, stringSetInt},
+	"String.backSpace":     {0, osConstant(jackBackspace)},
+	"String.doubleQuote":   {0, osConstant(jackDoubleQuote)},
+	"String.newLine":       {0, osConstant(jackNewline)},
+
+	"Output.init":        {0, osNothing},
+	"Output.moveCursor":  {2, outputMoveCursor},
+	"Output.printChar":   {1, outputPrintChar},
+	"Output.printString": {1, outputPrintString},
+	"Output.printInt":    {1, outputPrintInt},
+	"Output.println":     {0, outputPrintln},
+	"Output.backSpace":   {0, outputBackSpace},
+
+	"Screen.init":          {0, osNothing},
+	"Screen.clearScreen":   {0, screenClear},
+	"Screen.setColor":      {1, screenSetColor},
+	"Screen.drawPixel":     {2, screenDrawPixel},
+	"Screen.drawLine":      {4, screenDrawLine},
+	"Screen.drawRectangle": {4, screenDrawRectangle},
+	"Screen.drawCircle":    {3, screenDrawCircle},
+
+	"Keyboard.init":       {0, osNothing},
+	"Keyboard.keyPressed": {0, keyboardKeyPressed},
+	"Keyboard.readChar":   {0, keyboardReadChar},
+	"Keyboard.readLine":   {1, keyboardReadLine},
+	"Keyboard.readInt":    {1, keyboardReadInt},
+
+	"Sys.halt":  {0, sysHalt},
+	"Sys.error": {1, sysError},
+	"Sys.wait":  {1, sysWait},
+}
+
+// Void functions return 0, as compiled void functions do.
+func osNothing(jos *jackOS, args []int16) (int16, error) {
+	return 0, nil
+}
+
+func osConstant(c int16) func(*jackOS, []int16) (int16, error) {
+	return func(jos *jackOS, args []int16) (int16, error) {
+		return c, nil
+	}
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// Math
+////////////////////////////////////////////////////////////////////////////////
+
+func mathAbs(jos *jackOS, args []int16) (int16, error) {
+	if args[0] < 0 {
+		return -args[0], nil
+	}
+
+	return args[0], nil
+}
+
+func mathMultiply(jos *jackOS, args []int16) (int16, error) {
+	return args[0] * args[1], nil
+}
+
+// Rounds towards zero, as the course's OS does.
+func mathDivide(jos *jackOS, args []int16) (int16, error) {
+	if args[1] == 0 {
+		return 0, jackError(3)
+	}
+
+	return args[0] / args[1], nil
+}
+
+func mathMin(jos *jackOS, args []int16) (int16, error) {
+	return int16(min(int(args[0]), int(args[1]))), nil
+}
+
+func mathMax(jos *jackOS, args []int16) (int16, error) {
+	return int16(max(int(args[0]), int(args[1]))), nil
+}
+
+func mathSqrt(jos *jackOS, args []int16) (int16, error) {
+	if args[0] < 0 {
+		return 0, jackError(4)
+	}
+
+	r := 0
+
+	for (r+1)*(r+1) <= int(args[0]) {
+		r++
+	}
+
+	return int16(r), nil
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// Memory and Array.  The heap's bookkeeping is kept in Go rather than
+// in the heap itself, so that the heap only ever holds Jack objects.
+////////////////////////////////////////////////////////////////////////////////
+
+func memoryPeek(jos *jackOS, args []int16) (int16, error) {
+	return jos.vm.RAM[uint16(args[0])%ramSize], nil
+}
+
+func memoryPoke(jos *jackOS, args []int16) (int16, error) {
+	jos.vm.RAM[uint16(args[0])%ramSize] = args[1]
+
+	return 0, nil
+}
+
+func memoryAlloc(jos *jackOS, args []int16) (int16, error) {
+	return jos.alloc(int(args[0]))
+}
+
+// First fit.
+func (jos *jackOS) alloc(size int) (int16, error) {
+	if size <= 0 {
+		return 0, jackError(5)
+	}
+
+	for i, b := range jos.free {
+		if b.size < size {
+			continue
+		}
+
+		if b.size == size {
+			jos.free = append(jos.free[:i], jos.free[i+1:]...)
+		} else {
+			jos.free[i] = heapBlock{b.addr + size, b.size - size}
+		}
+
+		jos.allocated[b.addr] = size
+
+		return int16(b.addr), nil
+	}
+
+	return 0, jackError(6)
+}
+
+// Returns the block to the free list, merging it with its neighbours.
+func memoryDeAlloc(jos *jackOS, args []int16) (int16, error) {
+	addr := int(args[0])
+	size, ok := jos.allocated[addr]
+
+	if !ok {
+		return 0, fmt.Errorf("Memory.deAlloc(%d): not an allocated block", addr)
+	}
+
+	delete(jos.allocated, addr)
+
+	i := 0
+	for i < len(jos.free) && jos.free[i].addr < addr {
+		i++
+	}
+
+	jos.free = append(jos.free[:i], append([]heapBlock{{addr, size}}, jos.free[i:]...)...)
+
+	if i+1 < len(jos.free) && addr+size == jos.free[i+1].addr {
+		jos.free[i].size += jos.free[i+1].size
+		jos.free = append(jos.free[:i+1], jos.free[i+2:]...)
+	}
+
+	if i > 0 && jos.free[i-1].addr+jos.free[i-1].size == addr {
+		jos.free[i-1].size += jos.free[i].size
+		jos.free = append(jos.free[:i], jos.free[i+1:]...)
+	}
+
+	return 0, nil
+}
+
+// Array.dispose and String.dispose.
+func osDispose(jos *jackOS, args []int16) (int16, error) {
+	return jos.invoke("Memory.deAlloc", args[0])
+}
+
+func arrayNew(jos *jackOS, args []int16) (int16, error) {
+	if args[0] <= 0 {
+		return 0, jackError(2)
+	}
+
+	return jos.invoke("Memory.alloc", args[0])
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// String.  A string is its maximum length, its length, then its
+// characters.
+////////////////////////////////////////////////////////////////////////////////
+
+func stringNew(jos *jackOS, args []int16) (int16, error) {
+	if args[0] < 0 {
+		return 0, jackError(14)
+	}
+
+	size := int(args[0]) + jackStringHeader
+
+	if size > math.MaxInt16 {
+		return 0, jackError(6)
+	}
+
+	s, err := jos.invoke("Memory.alloc", int16(size))
+
+	if err != nil {
+		return 0, err
+	}
+
+	jos.vm.RAM[s] = args[0]
+	jos.vm.RAM[s+1] = 0
+
+	return s, nil
+}
+
+// The maximum length, length and address of the first character.
+func (jos *jackOS) stringFields(s int16) (int, int, int) {
+	addr := int(uint16(s)) % (ramSize - jackStringHeader)
+
+	return int(jos.vm.RAM[addr]), int(jos.vm.RAM[addr+1]), addr + jackStringHeader
+}
+
+// The contents of a string, as a Go string.
+func (jos *jackOS) stringValue(s int16) string {
+	_, length, chars := jos.stringFields(s)
+	var b strings.Builder
+
+	for i := 0; i < length && chars+i < ramSize; i++ {
+		b.WriteByte(byte(jos.vm.RAM[chars+i]))
+	}
+
+	return b.String()
+}
+
+func stringLength(jos *jackOS, args []int16) (int16, error) {
+	_, length, _ := jos.stringFields(args[0])
+
+	return int16(length), nil
+}
+
+func stringCharAt(jos *jackOS, args []int16) (int16, error) {
+	_, length, chars := jos.stringFields(args[0])
+
+	if args[1] < 0 || int(args[1]) >= length || chars+int(args[1]) >= ramSize {
+		return 0, jackError(15)
+	}
+
+	return jos.vm.RAM[chars+int(args[1])], nil
+}
+
+func stringSetCharAt(jos *jackOS, args []int16) (int16, error) {
+	_, length, chars := jos.stringFields(args[0])
+
+	if args[1] < 0 || int(args[1]) >= length || chars+int(args[1]) >= ramSize {
+		return 0, jackError(16)
+	}
+
+	jos.vm.RAM[chars+int(args[1])] = args[2]
+
+	return 0, nil
+}
+
+// Returns the string, so that calls can be chained.
+func stringAppendChar(jos *jackOS, args []int16) (int16, error) {
+	maxLength, length, chars := jos.stringFields(args[0])
+
+	if length < 0 || length >= maxLength || chars+length >= ramSize {
+		return 0, jackError(17)
+	}
+
+	jos.vm.RAM[chars+length] = args[1]
+	jos.vm.RAM[chars-1]++
+
+	return args[0], nil
+}
+
+func stringEraseLastChar(jos *jackOS, args []int16) (int16, error) {
+	_, length, chars := jos.stringFields(args[0])
+
+	if length <= 0 {
+		return 0, jackError(18)
+	}
+
+	jos.vm.RAM[chars-1]--
+
+	return 0, nil
+}
+
+// The integer at the start of the string, stopping at the first
+// character that isn't a digit.
+func stringIntValue(jos *jackOS, args []int16) (int16, error) {
+	s := jos.stringValue(args[0])
+	n := int16(0)
+	negative := strings.HasPrefix(s, "-")
+
+	if negative {
+		s = s[1:]
+	}
+
+	for _, c := range s {
+		if c < '0' || c > '9' {
+			break
+		}
+
+		n = n*10 + int16(c-'0')
+	}
+
+	if negative {
+		n = -n
+	}
+
+	return n, nil
+}
+
+func stringSetInt(jos *jackOS, args []int16) (int16, error) {
+	maxLength, _, chars := jos.stringFields(args[0])
+	digits := strconv.Itoa(int(args[1]))
+
+	if len(digits) > maxLength || chars+len(digits) > ramSize {
+		return 0, jackError(19)
+	}
+
+	for i, c := range digits {
+		jos.vm.RAM[chars+i] = int16(c)
+	}
+
+	jos.vm.RAM[chars-1] = int16(len(digits))
+
+	return 0, nil
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// Output
+////////////////////////////////////////////////////////////////////////////////
+
+func (jos *jackOS) clearText() {
+	for r := range jos.text {
+		for c := range jos.text[r] {
+			jos.text[r][c] = ' '
+		}
+	}
+}
+
+func outputMoveCursor(jos *jackOS, args []int16) (int16, error) {
+	if args[0] < 0 || args[0] >= outputRows || args[1] < 0 || args[1] >= outputColumns {
+		return 0, jackError(20)
+	}
+
+	jos.row, jos.col = int(args[0]), int(args[1])
+
+	return 0, nil
+}
+
+// Newline and backspace are handled, as they are by the course's OS.
+func outputPrintChar(jos *jackOS, args []int16) (int16, error) {
+	switch c := args[0]; c {
+	case jackNewline:
+		return outputPrintln(jos, nil)
+
+	case jackBackspace:
+		return outputBackSpace(jos, nil)
+
+	default:
+		jos.text[jos.row][jos.col] = byte(c)
+		fmt.Fprintf(jos.out, "%c", byte(c))
+
+		if jos.col++; jos.col == outputColumns {
+			return outputPrintln(jos, nil)
+		}
+	}
+
+	return 0, nil
+}
+
+func outputPrintString(jos *jackOS, args []int16) (int16, error) {
+	length, err := jos.invoke("String.length", args[0])
+
+	for i := int16(0); err == nil && i < length; i++ {
+		var c int16
+
+		if c, err = jos.invoke("String.charAt", args[0], i); err == nil {
+			_, err = outputPrintChar(jos, []int16{c})
+		}
+	}
+
+	return 0, err
+}
+
+func outputPrintInt(jos *jackOS, args []int16) (int16, error) {
+	for _, c := range strconv.Itoa(int(args[0])) {
+		outputPrintChar(jos, []int16{int16(c)})
+	}
+
+	return 0, nil
+}
+
+// Wraps back round to the top after the last row.
+func outputPrintln(jos *jackOS, args []int16) (int16, error) {
+	jos.col = 0
+	jos.row = (jos.row + 1) % outputRows
+	fmt.Fprintln(jos.out)
+
+	return 0, nil
+}
+
+func outputBackSpace(jos *jackOS, args []int16) (int16, error) {
+	switch {
+	case jos.col > 0:
+		jos.col--
+	case jos.row > 0:
+		jos.row, jos.col = jos.row-1, outputColumns-1
+	}
+
+	jos.text[jos.row][jos.col] = ' '
+	fmt.Fprint(jos.out, "\b \b")
+
+	return 0, nil
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// Screen
+////////////////////////////////////////////////////////////////////////////////
+
+func screenClear(jos *jackOS, args []int16) (int16, error) {
+	for a := screenBase; a < kbdAddress; a++ {
+		jos.vm.RAM[a] = 0
+	}
+
+	return 0, nil
+}
+
+func screenSetColor(jos *jackOS, args []int16) (int16, error) {
+	jos.black = args[0] != 0
+
+	return 0, nil
+}
+
+func onScreen(x, y int) bool {
+	return x >= 0 && x < screenWidth && y >= 0 && y < screenHeight
+}
+
+// Pixels off the screen are ignored.
+func (jos *jackOS) setPixel(x, y int) {
+	if !onScreen(x, y) {
+		return
+	}
+
+	addr := screenBase + y*screenRowWords + x/16
+	bit := int16(1) << uint(x%16)
+
+	if jos.black {
+		jos.vm.RAM[addr] |= bit
+	} else {
+		jos.vm.RAM[addr] &^= bit
+	}
+}
+
+func screenDrawPixel(jos *jackOS, args []int16) (int16, error) {
+	if !onScreen(int(args[0]), int(args[1])) {
+		return 0, jackError(7)
+	}
+
+	jos.setPixel(int(args[0]), int(args[1]))
+
+	return 0, nil
+}
+
+// Bresenham's, in all directions.
+func screenDrawLine(jos *jackOS, args []int16) (int16, error) {
+	x1, y1, x2, y2 := int(args[0]), int(args[1]), int(args[2]), int(args[3])
+
+	if !onScreen(x1, y1) || !onScreen(x2, y2) {
+		return 0, jackError(8)
+	}
+
+	dx, sx := x2-x1, 1
+	dy, sy := y1-y2, 1
+
+	if dx < 0 {
+		dx, sx = -dx, -1
+	}
+
+	if dy > 0 {
+		dy = -dy
+	}
+
+	if y2 < y1 {
+		sy = -1
+	}
+
+	e := dx + dy
+
+	for {
+		jos.setPixel(x1, y1)
+
+		if x1 == x2 && y1 == y2 {
+			return 0, nil
+		}
+
+		if 2*e >= dy {
+			e += dy
+			x1 += sx
+		}
+
+		if 2*e <= dx {
+			e += dx
+			y1 += sy
+		}
+	}
+}
+
+func screenDrawRectangle(jos *jackOS, args []int16) (int16, error) {
+	x1, y1, x2, y2 := int(args[0]), int(args[1]), int(args[2]), int(args[3])
+
+	if !onScreen(x1, y1) || !onScreen(x2, y2) || x1 > x2 || y1 > y2 {
+		return 0, jackError(9)
+	}
+
+	for y := y1; y <= y2; y++ {
+		for x := x1; x <= x2; x++ {
+			jos.setPixel(x, y)
+		}
+	}
+
+	return 0, nil
+}
+
+// Filled, with anything off the edge of the screen clipped.
+func screenDrawCircle(jos *jackOS, args []int16) (int16, error) {
+	cx, cy, r := int(args[0]), int(args[1]), int(args[2])
+
+	if !onScreen(cx, cy) {
+		return 0, jackError(12)
+	}
+
+	if r < 0 || r > jackMaxRadius {
+		return 0, jackError(13)
+	}
+
+	for dy := -r; dy <= r; dy++ {
+		for dx := -r; dx <= r; dx++ {
+			if dx*dx+dy*dy <= r*r {
+				jos.setPixel(cx+dx, cy+dy)
+			}
+		}
+	}
+
+	return 0, nil
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// Keyboard.  keyPressed reads the keyboard register, as the course's
+// OS does, but the reads block on the console instead.
+////////////////////////////////////////////////////////////////////////////////
+
+func keyboardKeyPressed(jos *jackOS, args []int16) (int16, error) {
+	return jos.vm.RAM[kbdAddress], nil
+}
+
+// Echoes the character, as the course's OS does.
+func keyboardReadChar(jos *jackOS, args []int16) (int16, error) {
+	if jos.in == nil {
+		return 0, fmt.Errorf("Keyboard.readChar: no keyboard input")
+	}
+
+	b, err := jos.in.ReadByte()
+
+	if err != nil {
+		return 0, fmt.Errorf("Keyboard.readChar: %s", err)
+	}
+
+	c := int16(b)
+
+	switch b {
+	case '\n':
+		c = jackNewline
+	case '\b', 127:
+		c = jackBackspace
+	}
+
+	if c != jackBackspace {
+		if _, err := jos.invoke("Output.printChar", c); err != nil {
+			return 0, err
+		}
+	}
+
+	return c, nil
+}
+
+func keyboardReadLine(jos *jackOS, args []int16) (int16, error) {
+	if _, err := jos.invoke("Output.printString", args[0]); err != nil {
+		return 0, err
+	}
+
+	s, err := jos.invoke("String.new", jackLineLength)
+
+	if err != nil {
+		return 0, err
+	}
+
+	for {
+		c, err := keyboardReadChar(jos, nil)
+
+		if err != nil {
+			return 0, err
+		}
+
+		length, err := jos.invoke("String.length", s)
+
+		switch {
+		case err != nil:
+			return 0, err
+
+		case c == jackNewline:
+			return s, nil
+
+		case c == jackBackspace:
+			if length > 0 {
+				if _, err = jos.invoke("String.eraseLastChar", s); err == nil {
+					_, err = jos.invoke("Output.backSpace")
+				}
+			}
+
+		case length < jackLineLength:
+			_, err = jos.invoke("String.appendChar", s, c)
+		}
+
+		if err != nil {
+			return 0, err
+		}
+	}
+}
+
+func keyboardReadInt(jos *jackOS, args []int16) (int16, error) {
+	s, err := keyboardReadLine(jos, args)
+
+	if err != nil {
+		return 0, err
+	}
+
+	n, err := jos.invoke("String.intValue", s)
+
+	if err != nil {
+		return 0, err
+	}
+
+	_, err = jos.invoke("String.dispose", s)
+
+	return n, err
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// Sys.  Sys.init isn't needed, the machine is bootstrapped with
+// Main.main if there isn't one.
+////////////////////////////////////////////////////////////////////////////////
+
+func sysHalt(jos *jackOS, args []int16) (int16, error) {
+	jos.vm.PC = -1
+
+	return 0, nil
+}
+
+func sysError(jos *jackOS, args []int16) (int16, error) {
+	return 0, jackError(args[0])
+}
+
+// Runs headlessly, so there's nothing to wait for.
+func sysWait(jos *jackOS, args []int16) (int16, error) {
+	if args[0] < 0 {
+		return 0, jackError(1)
+	}
+
+	return 0, nil
+}
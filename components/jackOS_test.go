@@ -0,0 +1,226 @@
+package components
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestJackOSProgram(t *testing.T) {
+	prog, err := LoadVMProgram("testdata/vm/Square")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var out strings.Builder
+	vm := NewVMachine(prog)
+	vm.SetConsole(strings.NewReader("12\n"), &out)
+	vm.Run(1000)
+
+	if !vm.Halted() || vm.Err() != nil {
+		t.Fatalf("Expected to halt cleanly, error was %v", vm.Err())
+	}
+
+	if out.String() != "n?12\n144\n" {
+		t.Errorf("Unexpected output: %q", out.String())
+	}
+
+	if console := vm.Console(); console[0] != "n?12" || console[1] != "144" {
+		t.Errorf("Unexpected console: %q", console[:2])
+	}
+
+	if vm.RAM[screenBase] != -1 || vm.RAM[screenBase+1] != 0 {
+		t.Errorf("Expected the first 16 pixels set, got %d and %d", vm.RAM[screenBase], vm.RAM[screenBase+1])
+	}
+}
+
+var jackOSErrors = []struct {
+	source   string
+	expected string
+}{
+	{"push constant 1\npush constant 0\ncall Math.divide 2", "Sys.error(3): Division by zero"},
+	{"push constant 0\ncall String.new 1\npush constant 65\ncall String.appendChar 2", "Sys.error(17): String is full"},
+	{"push constant 512\npush constant 0\ncall Screen.drawPixel 2", "Sys.error(7): Illegal pixel coordinates"},
+	{"push constant 1\ncall Math.divide 1", "Math.divide expects 2 arguments, called with 1"},
+	{"call Main.nothing 0", "Function Main.nothing is not defined"},
+	{"call Keyboard.readChar 0", "Keyboard.readChar: no keyboard input"},
+	{"push constant 32767\ncall String.new 1", "Sys.error(6): Heap overflow"},
+	{topString + "push constant 10\ncall String.charAt 2", "Sys.error(15): String index out of bounds"},
+	{topString + "push constant 10\npush constant 65\ncall String.setCharAt 3", "Sys.error(16): String index out of bounds"},
+	{topString + "push constant 65\ncall String.appendChar 2", "Sys.error(17): String is full"},
+	{topString + "push constant 12345\ncall String.setInt 2", "Sys.error(19): Insufficient string capacity"},
+}
+
+// A string at the very top of RAM, claiming to have room for 100
+// characters and to hold 50, then pushed ready for a call.
+const topString = `push constant 32765
+push constant 100
+call Memory.poke 2
+pop temp 0
+push constant 32766
+push constant 50
+call Memory.poke 2
+pop temp 0
+push constant 32765
+`
+
+func TestJackOSErrors(t *testing.T) {
+	for _, test := range jackOSErrors {
+		prog, err := ParseVM([]string{"Test"}, map[string]string{"Test": test.source})
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		vm := NewVMachine(prog)
+		vm.RAM[vmSP] = vmStack
+		vm.Run(100)
+
+		if vm.Err() == nil || !strings.HasSuffix(vm.Err().Error(), test.expected) {
+			t.Errorf("%q: expected %q, got %v", test.source, test.expected, vm.Err())
+		}
+	}
+}
+
+func TestJackOSHeap(t *testing.T) {
+	vm := NewVMachine(&VMProgram{})
+	jos := vm.jos
+
+	a, _ := memoryAlloc(jos, []int16{10})
+	b, _ := memoryAlloc(jos, []int16{20})
+	c, _ := memoryAlloc(jos, []int16{30})
+
+	if a != vmHeap || b != vmHeap+10 || c != vmHeap+30 {
+		t.Fatalf("Expected consecutive blocks, got %d, %d and %d", a, b, c)
+	}
+
+	memoryDeAlloc(jos, []int16{a})
+	memoryDeAlloc(jos, []int16{c})
+	memoryDeAlloc(jos, []int16{b})
+
+	if len(jos.free) != 1 || jos.free[0] != (heapBlock{vmHeap, heapEnd - vmHeap}) {
+		t.Errorf("Expected the free blocks to be merged, got %v", jos.free)
+	}
+
+	if _, err := memoryAlloc(jos, []int16{heapEnd - vmHeap + 1}); err != jackError(6) {
+		t.Errorf("Expected a heap overflow, got %v", err)
+	}
+
+	if _, err := memoryDeAlloc(jos, []int16{a}); err == nil {
+		t.Error("Expected freeing a free block to fail")
+	}
+}
+
+// A bump allocator from 10000, in place of the built in Memory.
+const studentMemory = `function Memory.alloc 0
+push constant 10000
+push static 0
+add
+push static 0
+push argument 0
+add
+pop static 0
+return
+function Memory.deAlloc 0
+push constant 0
+return`
+
+// Strings as their length then their characters, in place of the built
+// in String.
+const studentString = `function String.new 0
+push argument 0
+push constant 1
+add
+call Memory.alloc 1
+pop pointer 0
+push constant 0
+pop this 0
+push pointer 0
+return
+function String.length 0
+push argument 0
+pop pointer 0
+push this 0
+return
+function String.charAt 0
+push argument 0
+push argument 1
+add
+push constant 1
+add
+pop pointer 1
+push that 0
+return
+function String.appendChar 0
+push argument 0
+pop pointer 0
+push this 0
+push constant 1
+add
+push pointer 0
+add
+pop pointer 1
+push argument 1
+pop that 0
+push this 0
+push constant 1
+add
+pop this 0
+push pointer 0
+return`
+
+// The built in OS uses the program's own Memory and String, when they're
+// loaded, as project 12 does one class at a time.
+func TestJackOSReplaced(t *testing.T) {
+	prog, err := ParseVM([]string{"Main", "Memory"}, map[string]string{
+		"Main":   "function Main.main 0\npush constant 3\ncall Array.new 1\npop static 0\npush constant 5\ncall String.new 1\npop static 1\nlabel END\ngoto END",
+		"Memory": studentMemory,
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	vm := NewVMachine(prog)
+	vm.Run(1000)
+
+	array, str := vm.RAM[vm.statics["Main.0"]], vm.RAM[vm.statics["Main.1"]]
+
+	if vm.Err() != nil || array != 10000 || str != 10003 || vm.RAM[str] != 5 {
+		t.Errorf("Expected the array at 10000 and a string for 5 characters at 10003, got %d and %d (%v)", array, str, vm.Err())
+	}
+
+	prog, err = ParseVM([]string{"Main", "String"}, map[string]string{
+		"Main": `function Main.main 0
+push constant 2
+call String.new 1
+push constant 72
+call String.appendChar 2
+push constant 105
+call String.appendChar 2
+call Output.printString 1
+pop temp 0
+call Output.println 0
+pop temp 0
+push constant 0
+call String.new 1
+call Keyboard.readLine 1
+call Output.printString 1
+pop temp 0
+label END
+goto END`,
+		"String": studentString,
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	vm = NewVMachine(prog)
+	vm.SetConsole(strings.NewReader("ok\n"), &strings.Builder{})
+	vm.Run(1000)
+
+	if console := vm.Console(); vm.Err() != nil || console[0] != "Hi" || console[1] != "ok" || console[2] != "ok" {
+		t.Errorf("Expected Hi then ok (echoed and printed), got %q (%v)", console[:3], vm.Err())
+	}
+}
@@ -0,0 +1,758 @@
+/*
+ Front end for Jack, the course's object based language (chapters 9
+ and 10).  As with the HDL it's a tokeniser and a recursive descent
+ parser, giving a tree for each class that the checker works from.
+
+ Expressions have no precedence in Jack, a + b * c is (a + b) * c, so
+ a binary expression's left operand is everything before the operator.
+ The target of a let is parsed as any term, rather than just a variable
+ or array element, so that the checker can say what's wrong with it.
+*/
+
+package components
+
+import (
+	"fmt"
+	"io/ioutil"
+	"strconv"
+	"strings"
+)
+
+type jackTokenKind int
+
+const (
+	jackKeyword jackTokenKind = iota
+	jackSymbol
+	jackIntConst
+	jackStringConst
+	jackIdentifier
+	jackEOF
+)
+
+var jackKeywords = map[string]bool{
+	"class": true, "constructor": true, "function": true, "method": true,
+	"field": true, "static": true, "var": true, "int": true, "char": true,
+	"boolean": true, "void": true, "true": true, "false": true, "null": true,
+	"this": true, "let": true, "do": true, "if": true, "else": true,
+	"while": true, "return": true,
+}
+
+const jackSymbols = "{}()[].,;+-*/&|<>=~"
+const jackOps = "+-*/&|<>="
+const jackMaxInt = 32767
+
+// JackDiagnostic is a problem found in a Jack program.
+type JackDiagnostic struct {
+	File    string
+	Line    int
+	Column  int
+	Message string
+}
+
+func (d JackDiagnostic) Error() string {
+	return fmt.Sprintf("%s:%d:%d: %s", d.File, d.Line, d.Column, d.Message)
+}
+
+// JackProgram is one or more parsed classes, a class per file.
+type JackProgram struct {
+	classes []*jackClass
+}
+
+type jackPos struct {
+	Line   int `json:"line"`
+	Column int `json:"column"`
+}
+
+// The tree's fields are exported so that it can be written as JSON.
+type jackClass struct {
+	Name        string           `json:"name"`
+	Pos         jackPos          `json:"pos"`
+	Vars        []jackVarDec     `json:"vars"`
+	Subroutines []jackSubroutine `json:"subroutines"`
+	file        string
+	tokens      []jackToken // for writing out as XML
+}
+
+type jackVarDec struct {
+	Kind  string     `json:"kind"` // static, field, argument or var
+	Type  string     `json:"type"`
+	Names []jackName `json:"names"`
+}
+
+type jackName struct {
+	Name string  `json:"name"`
+	Pos  jackPos `json:"pos"`
+}
+
+type jackSubroutine struct {
+	Kind   string          `json:"kind"` // constructor, function or method
+	Type   string          `json:"type"` // what it returns, or void
+	Name   string          `json:"name"`
+	Pos    jackPos         `json:"pos"`
+	Params []jackVarDec    `json:"params"`
+	Locals []jackVarDec    `json:"locals"`
+	Body   []jackStatement `json:"body"`
+	End    jackPos         `json:"end"` // the closing brace
+}
+
+type jackStatement struct {
+	Kind    string          `json:"kind"` // let, if, while, do or return
+	Pos     jackPos         `json:"pos"`
+	Target  *jackExpr       `json:"target,omitempty"` // what a let assigns to
+	Value   *jackExpr       `json:"value,omitempty"`  // a let's value, a condition, a do's call, or what's returned
+	Body    []jackStatement `json:"body,omitempty"`   // if and while
+	Else    []jackStatement `json:"else,omitempty"`
+	HasElse bool            `json:"hasElse,omitempty"`
+}
+
+// Constants (int, string and keyword) and variables (var) just have
+// a Value.  An index is Value[Operands[0]], a call is
+// Object.Value(Operands...) with Object empty for a call within the
+// class, unary and binary have the operator as their Value, and a
+// group is an expression in brackets.
+type jackExpr struct {
+	Kind     string      `json:"kind"`
+	Pos      jackPos     `json:"pos"`
+	Value    string      `json:"value,omitempty"`
+	Object   string      `json:"object,omitempty"`
+	Operands []*jackExpr `json:"operands,omitempty"`
+}
+
+// LoadJackProgram parses one or more .jack files, or directories of
+// them, as a single program.
+func LoadJackProgram(paths ...string) (*JackProgram, error) {
+	files, err := sourceFiles(".jack", paths)
+
+	if err != nil {
+		return nil, err
+	}
+
+	sources := make(map[string]string)
+
+	for _, f := range files {
+		b, err := ioutil.ReadFile(f)
+
+		if err != nil {
+			return nil, err
+		}
+
+		sources[f] = string(b)
+	}
+
+	return ParseJack(files, sources)
+}
+
+// ParseJack parses the given sources, keyed by file name, in the
+// order given by files.  Syntax errors are JackDiagnostics, one per
+// file at most.
+func ParseJack(files []string, sources map[string]string) (*JackProgram, error) {
+	var prog JackProgram
+	var errs errorList
+
+	for _, f := range files {
+		class, err := parseJackClass(f, sources[f])
+
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+
+		prog.classes = append(prog.classes, class)
+	}
+
+	if len(errs) > 0 {
+		return nil, errs.asError()
+	}
+
+	return &prog, nil
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// Tokeniser
+////////////////////////////////////////////////////////////////////////////////
+
+type jackToken struct {
+	kind  jackTokenKind
+	value string // without the quotes for strings
+	pos   jackPos
+}
+
+// Always ends with an EOF token.
+func tokeniseJack(file, source string) ([]jackToken, error) {
+	var tokens []jackToken
+	line, lineStart := 1, 0
+	i := 0
+
+	at := func() jackPos { return jackPos{line, i - lineStart + 1} }
+
+	fail := func(format string, args ...interface{}) error {
+		pos := at()
+		return JackDiagnostic{file, pos.Line, pos.Column, fmt.Sprintf(format, args...)}
+	}
+
+	for i < len(source) {
+		c := source[i]
+
+		switch {
+		case c == '\n':
+			i++
+			line, lineStart = line+1, i
+
+		case c == ' ' || c == '\t' || c == '\r':
+			i++
+
+		case strings.HasPrefix(source[i:], "//"):
+			for i < len(source) && source[i] != '\n' {
+				i++
+			}
+
+		case strings.HasPrefix(source[i:], "/*"):
+			end := strings.Index(source[i+2:], "*/")
+
+			if end == -1 {
+				return nil, fail("Unterminated comment")
+			}
+
+			for end += i + 4; i < end; i++ {
+				if source[i] == '\n' {
+					line, lineStart = line+1, i+1
+				}
+			}
+
+		case c == '"':
+			end := strings.IndexAny(source[i+1:], "\"\n")
+
+			if end == -1 || source[i+1+end] == '\n' {
+				return nil, fail("Unterminated string")
+			}
+
+			tokens = append(tokens, jackToken{jackStringConst, source[i+1 : i+1+end], at()})
+			i += end + 2
+
+		case strings.IndexByte(jackSymbols, c) != -1:
+			tokens = append(tokens, jackToken{jackSymbol, string(c), at()})
+			i++
+
+		case c >= '0' && c <= '9':
+			start := i
+
+			for i < len(source) && source[i] >= '0' && source[i] <= '9' {
+				i++
+			}
+
+			pos := jackPos{line, start - lineStart + 1}
+
+			if n, err := strconv.Atoi(source[start:i]); err != nil || n > jackMaxInt {
+				return nil, JackDiagnostic{file, pos.Line, pos.Column, fmt.Sprintf("Integer %s is larger than %d", source[start:i], jackMaxInt)}
+			}
+
+			tokens = append(tokens, jackToken{jackIntConst, source[start:i], pos})
+
+		case isJackIdentifier(c):
+			start := i
+
+			for i < len(source) && (isJackIdentifier(source[i]) || source[i] >= '0' && source[i] <= '9') {
+				i++
+			}
+
+			kind := jackIdentifier
+
+			if jackKeywords[source[start:i]] {
+				kind = jackKeyword
+			}
+
+			tokens = append(tokens, jackToken{kind, source[start:i], jackPos{line, start - lineStart + 1}})
+
+		default:
+			return nil, fail("Unexpected character %q", c)
+		}
+	}
+
+	return append(tokens, jackToken{jackEOF, "", at()}), nil
+}
+
+func isJackIdentifier(c byte) bool {
+	return c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// Parser
+////////////////////////////////////////////////////////////////////////////////
+
+type jackParser struct {
+	file   string
+	tokens []jackToken
+	pos    int
+}
+
+func parseJackClass(file, source string) (*jackClass, error) {
+	tokens, err := tokeniseJack(file, source)
+
+	if err != nil {
+		return nil, err
+	}
+
+	p := jackParser{file: file, tokens: tokens}
+	class, err := p.class()
+
+	if err != nil {
+		return nil, err
+	}
+
+	class.file = file
+	class.tokens = tokens[:len(tokens)-1]
+
+	return class, nil
+}
+
+func (p *jackParser) peek() jackToken {
+	return p.tokens[p.pos]
+}
+
+// Stays on the EOF token once it's reached.
+func (p *jackParser) next() jackToken {
+	t := p.peek()
+
+	if t.kind != jackEOF {
+		p.pos++
+	}
+
+	return t
+}
+
+// True if the current token is a keyword or symbol, and one of values.
+func (p *jackParser) at(values ...string) bool {
+	t := p.peek()
+
+	if t.kind != jackKeyword && t.kind != jackSymbol {
+		return false
+	}
+
+	for _, v := range values {
+		if t.value == v {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (p *jackParser) expect(value string) (jackToken, error) {
+	if !p.at(value) {
+		return p.peek(), p.unexpected(p.peek(), "'"+value+"'")
+	}
+
+	return p.next(), nil
+}
+
+func (p *jackParser) identifier(what string) (jackToken, error) {
+	if p.peek().kind != jackIdentifier {
+		return p.peek(), p.unexpected(p.peek(), what)
+	}
+
+	return p.next(), nil
+}
+
+// int, char, boolean or a class name, or also void if allowed.
+func (p *jackParser) typeName(void bool) (string, error) {
+	if p.at("int", "char", "boolean") || (void && p.at("void")) {
+		return p.next().value, nil
+	}
+
+	if p.peek().kind != jackIdentifier {
+		if void {
+			return "", p.unexpected(p.peek(), "a type or void")
+		}
+
+		return "", p.unexpected(p.peek(), "a type")
+	}
+
+	return p.next().value, nil
+}
+
+func (p *jackParser) unexpected(t jackToken, expected string) error {
+	found := "end of file"
+
+	switch t.kind {
+	case jackStringConst:
+		found = strconv.Quote(t.value)
+	case jackEOF:
+	default:
+		found = "'" + t.value + "'"
+	}
+
+	return JackDiagnostic{p.file, t.pos.Line, t.pos.Column, fmt.Sprintf("Expected %s but found %s", expected, found)}
+}
+
+// class Name { classVarDec* subroutineDec* }
+func (p *jackParser) class() (*jackClass, error) {
+	if _, err := p.expect("class"); err != nil {
+		return nil, err
+	}
+
+	name, err := p.identifier("a class name")
+
+	if err != nil {
+		return nil, err
+	}
+
+	class := jackClass{Name: name.value, Pos: name.pos}
+
+	if _, err := p.expect("{"); err != nil {
+		return nil, err
+	}
+
+	for p.at("static", "field") {
+		kind := p.next().value
+		dec, err := p.varDec(kind)
+
+		if err != nil {
+			return nil, err
+		}
+
+		class.Vars = append(class.Vars, dec)
+	}
+
+	for p.at("constructor", "function", "method") {
+		sub, err := p.subroutine()
+
+		if err != nil {
+			return nil, err
+		}
+
+		class.Subroutines = append(class.Subroutines, sub)
+	}
+
+	if _, err := p.expect("}"); err != nil {
+		if len(class.Subroutines) == 0 {
+			return nil, p.unexpected(p.peek(), "static, field, constructor, function, method or '}'")
+		}
+
+		return nil, p.unexpected(p.peek(), "constructor, function, method or '}'")
+	}
+
+	if p.peek().kind != jackEOF {
+		return nil, p.unexpected(p.peek(), "end of file")
+	}
+
+	return &class, nil
+}
+
+// type name (, name)* ; with the keyword already read.
+func (p *jackParser) varDec(kind string) (jackVarDec, error) {
+	dec := jackVarDec{Kind: kind}
+	var err error
+
+	if dec.Type, err = p.typeName(false); err != nil {
+		return dec, err
+	}
+
+	for {
+		name, err := p.identifier("a variable name")
+
+		if err != nil {
+			return dec, err
+		}
+
+		dec.Names = append(dec.Names, jackName{name.value, name.pos})
+
+		if p.at(";") {
+			p.next()
+			return dec, nil
+		}
+
+		if _, err := p.expect(","); err != nil {
+			return dec, p.unexpected(p.peek(), "',' or ';'")
+		}
+	}
+}
+
+// kind type name (parameters) { varDec* statements }
+func (p *jackParser) subroutine() (jackSubroutine, error) {
+	sub := jackSubroutine{Kind: p.next().value}
+	var err error
+
+	if sub.Type, err = p.typeName(true); err != nil {
+		return sub, err
+	}
+
+	name, err := p.identifier("a subroutine name")
+
+	if err != nil {
+		return sub, err
+	}
+
+	sub.Name, sub.Pos = name.value, name.pos
+
+	if _, err := p.expect("("); err != nil {
+		return sub, err
+	}
+
+	for !p.at(")") {
+		if len(sub.Params) > 0 {
+			if _, err := p.expect(","); err != nil {
+				return sub, p.unexpected(p.peek(), "',' or ')'")
+			}
+		}
+
+		dec := jackVarDec{Kind: "argument"}
+
+		if dec.Type, err = p.typeName(false); err != nil {
+			return sub, err
+		}
+
+		if name, err = p.identifier("a parameter name"); err != nil {
+			return sub, err
+		}
+
+		dec.Names = []jackName{{name.value, name.pos}}
+		sub.Params = append(sub.Params, dec)
+	}
+
+	p.next()
+
+	if _, err := p.expect("{"); err != nil {
+		return sub, err
+	}
+
+	for p.at("var") {
+		p.next()
+		dec, err := p.varDec("var")
+
+		if err != nil {
+			return sub, err
+		}
+
+		sub.Locals = append(sub.Locals, dec)
+	}
+
+	if sub.Body, err = p.statements(); err != nil {
+		return sub, err
+	}
+
+	end, err := p.expect("}")
+	sub.End = end.pos
+
+	return sub, err
+}
+
+// Statements up to a closing brace, which is left to be read.
+func (p *jackParser) statements() ([]jackStatement, error) {
+	var statements []jackStatement
+
+	for !p.at("}") {
+		s, err := p.statement()
+
+		if err != nil {
+			return nil, err
+		}
+
+		statements = append(statements, s)
+	}
+
+	return statements, nil
+}
+
+func (p *jackParser) statement() (jackStatement, error) {
+	if !p.at("let", "if", "while", "do", "return") {
+		return jackStatement{}, p.unexpected(p.peek(), "a statement or '}'")
+	}
+
+	t := p.next()
+	s := jackStatement{Kind: t.value, Pos: t.pos}
+	var err error
+
+	switch s.Kind {
+	case "let":
+		if s.Target, err = p.term(); err != nil {
+			return s, err
+		}
+
+		if _, err = p.expect("="); err == nil {
+			s.Value, err = p.expression()
+		}
+
+	case "if", "while":
+		if s.Value, s.Body, err = p.block(); err != nil || s.Kind == "while" || !p.at("else") {
+			return s, err
+		}
+
+		p.next()
+		s.HasElse = true
+
+		if _, err = p.expect("{"); err == nil {
+			if s.Else, err = p.statements(); err == nil {
+				_, err = p.expect("}")
+			}
+		}
+
+		return s, err
+
+	case "do":
+		var name jackToken
+
+		if name, err = p.identifier("a subroutine call"); err == nil {
+			s.Value, err = p.call(name)
+		}
+
+	case "return":
+		if !p.at(";") {
+			s.Value, err = p.expression()
+		}
+	}
+
+	if err != nil {
+		return s, err
+	}
+
+	_, err = p.expect(";")
+
+	return s, err
+}
+
+// (condition) { statements }
+func (p *jackParser) block() (*jackExpr, []jackStatement, error) {
+	if _, err := p.expect("("); err != nil {
+		return nil, nil, err
+	}
+
+	condition, err := p.expression()
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if _, err := p.expect(")"); err != nil {
+		return nil, nil, err
+	}
+
+	if _, err := p.expect("{"); err != nil {
+		return nil, nil, err
+	}
+
+	body, err := p.statements()
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	_, err = p.expect("}")
+
+	return condition, body, err
+}
+
+// term (op term)*
+func (p *jackParser) expression() (*jackExpr, error) {
+	e, err := p.term()
+
+	for err == nil && p.peek().kind == jackSymbol && strings.Contains(jackOps, p.peek().value) {
+		op := p.next()
+		var rhs *jackExpr
+
+		if rhs, err = p.term(); err == nil {
+			e = &jackExpr{Kind: "binary", Pos: op.pos, Value: op.value, Operands: []*jackExpr{e, rhs}}
+		}
+	}
+
+	return e, err
+}
+
+func (p *jackParser) term() (*jackExpr, error) {
+	t := p.next()
+	e := jackExpr{Pos: t.pos, Value: t.value}
+
+	switch {
+	case t.kind == jackIntConst:
+		e.Kind = "int"
+
+	case t.kind == jackStringConst:
+		e.Kind = "string"
+
+	case t.kind == jackKeyword && (t.value == "true" || t.value == "false" || t.value == "null" || t.value == "this"):
+		e.Kind = "keyword"
+
+	case t.kind == jackSymbol && (t.value == "-" || t.value == "~"):
+		operand, err := p.term()
+		e.Kind = "unary"
+		e.Operands = []*jackExpr{operand}
+
+		return &e, err
+
+	case t.kind == jackSymbol && t.value == "(":
+		inner, err := p.expression()
+
+		if err == nil {
+			_, err = p.expect(")")
+		}
+
+		e.Kind = "group"
+		e.Value = ""
+		e.Operands = []*jackExpr{inner}
+
+		return &e, err
+
+	case t.kind == jackIdentifier && p.at("["):
+		p.next()
+		index, err := p.expression()
+
+		if err == nil {
+			_, err = p.expect("]")
+		}
+
+		e.Kind = "index"
+		e.Operands = []*jackExpr{index}
+
+		return &e, err
+
+	case t.kind == jackIdentifier && p.at("(", "."):
+		return p.call(t)
+
+	case t.kind == jackIdentifier:
+		e.Kind = "var"
+
+	default:
+		return nil, p.unexpected(t, "a term")
+	}
+
+	return &e, nil
+}
+
+// name(args) or name.name(args), with the first name already read.
+func (p *jackParser) call(name jackToken) (*jackExpr, error) {
+	e := jackExpr{Kind: "call", Pos: name.pos, Value: name.value}
+
+	if p.at(".") {
+		p.next()
+		sub, err := p.identifier("a subroutine name")
+
+		if err != nil {
+			return nil, err
+		}
+
+		e.Object, e.Value = name.value, sub.value
+	}
+
+	if _, err := p.expect("("); err != nil {
+		return nil, err
+	}
+
+	for !p.at(")") {
+		if len(e.Operands) > 0 {
+			if _, err := p.expect(","); err != nil {
+				return nil, p.unexpected(p.peek(), "',' or ')'")
+			}
+		}
+
+		arg, err := p.expression()
+
+		if err != nil {
+			return nil, err
+		}
+
+		e.Operands = append(e.Operands, arg)
+	}
+
+	p.next()
+
+	return &e, nil
+}
@@ -0,0 +1,78 @@
+package components
+
+import (
+	"testing"
+)
+
+func TestJackParse(t *testing.T) {
+	prog, err := LoadJackProgram("testdata/jack/ArrayTest")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	main := prog.classes[0]
+
+	if main.Name != "Main" || len(main.Subroutines) != 1 || main.Subroutines[0].Name != "main" {
+		t.Fatalf("Unexpected class: %+v", main)
+	}
+
+	sub := main.Subroutines[0]
+
+	if len(sub.Locals) != 3 || len(sub.Locals[2].Names) != 2 || len(sub.Body) != 11 {
+		t.Fatalf("Expected 3 var declarations and 11 statements, got %+v", sub)
+	}
+
+	// let sum = sum + a[i];
+	let := sub.Body[6].Body[0]
+	value := let.Value
+
+	if let.Target.Value != "sum" || value.Kind != "binary" || value.Operands[1].Kind != "index" {
+		t.Errorf("Unexpected let: %+v", let)
+	}
+
+	if let.Pos != (jackPos{28, 6}) || value.Pos != (jackPos{28, 20}) {
+		t.Errorf("Expected the let at 28:6 and the + at 28:20, got %v and %v", let.Pos, value.Pos)
+	}
+}
+
+// No precedence, so a + b * c is (a + b) * c
+func TestJackExpressions(t *testing.T) {
+	class, err := parseJackClass("Main.jack", "class Main { function int f() { return a + b * -(c - d); } }")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	e := class.Subroutines[0].Body[0].Value
+
+	if e.Value != "*" || e.Operands[0].Value != "+" || e.Operands[1].Kind != "unary" || e.Operands[1].Operands[0].Kind != "group" {
+		t.Errorf("Unexpected expression: %+v", e)
+	}
+}
+
+var badJack = []struct {
+	source   string
+	expected string
+}{
+	{"class Main {", "Main.jack:1:13: Expected static, field, constructor, function, method or '}' but found end of file"},
+	{"class Main { field int x y; }", "Main.jack:1:26: Expected ',' or ';' but found 'y'"},
+	{"class Main {\n  function void f() {\n    let x = ;\n  }\n}", "Main.jack:3:13: Expected a term but found ';'"},
+	{"class Main { function void f() { do x; } }", "Main.jack:1:38: Expected '(' but found ';'"},
+	{"class Main { function void f() { var int x; let x = 32768; } }", "Main.jack:1:53: Integer 32768 is larger than 32767"},
+	{"class Main { function void f() { do g(\"abc); } }", "Main.jack:1:39: Unterminated string"},
+	{"class Main { /* nothing", "Main.jack:1:14: Unterminated comment"},
+	{"class Main { function void f() { return 1 # 2; } }", "Main.jack:1:43: Unexpected character '#'"},
+	{"class Main { } }", "Main.jack:1:16: Expected end of file but found '}'"},
+	{"class Main { function void f() { if (x) { } else return; } }", "Main.jack:1:50: Expected '{' but found 'return'"},
+}
+
+func TestJackSyntaxErrors(t *testing.T) {
+	for _, test := range badJack {
+		_, err := parseJackClass("Main.jack", test.source)
+
+		if err == nil || err.Error() != test.expected {
+			t.Errorf("%q: expected %q, got %v", test.source, test.expected, err)
+		}
+	}
+}
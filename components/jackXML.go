@@ -0,0 +1,321 @@
+/*
+ Project 10's output: each class's tokens as XML (MainT.xml) and its
+ parse tree as XML (Main.xml), in the same layout as the course's own
+ files, so that they can be compared with its TextComparer.  Plus the
+ tree as JSON, for our own tools.
+
+ The parse tree's nodes come from the class's syntax tree, but the
+ terminals in them are the class's tokens, taken in order, so they're
+ written exactly as they were in the source.
+*/
+
+package components
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// JackOutputs selects the files WriteOutputs writes for each class.
+type JackOutputs struct {
+	Tokens bool // MainT.xml
+	Tree   bool // Main.xml
+	JSON   bool // Main.json
+}
+
+var jackTokenTags = map[jackTokenKind]string{
+	jackKeyword:     "keyword",
+	jackSymbol:      "symbol",
+	jackIntConst:    "integerConstant",
+	jackStringConst: "stringConstant",
+	jackIdentifier:  "identifier",
+}
+
+var jackXMLEscapes = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;", "\"", "&quot;")
+
+// WriteOutputs writes the selected files for each class to dir, or
+// alongside the class's .jack file if dir is empty, and returns the
+// paths written.
+func (p *JackProgram) WriteOutputs(dir string, outputs JackOutputs) ([]string, error) {
+	var written []string
+
+	for _, class := range p.classes {
+		for _, o := range []struct {
+			enabled bool
+			suffix  string
+			write   func(io.Writer, *jackClass) error
+		}{
+			{outputs.Tokens, "T.xml", writeJackTokens},
+			{outputs.Tree, ".xml", writeJackTree},
+			{outputs.JSON, ".json", writeJackJSON},
+		} {
+			if !o.enabled {
+				continue
+			}
+
+			out := dir
+
+			if out == "" {
+				out = filepath.Dir(class.file)
+			}
+
+			path := filepath.Join(out, strings.TrimSuffix(filepath.Base(class.file), filepath.Ext(class.file))+o.suffix)
+
+			if err := writeJackFile(path, class, o.write); err != nil {
+				return written, err
+			}
+
+			written = append(written, path)
+		}
+	}
+
+	return written, nil
+}
+
+func writeJackFile(path string, class *jackClass, write func(io.Writer, *jackClass) error) error {
+	f, err := os.Create(path)
+
+	if err != nil {
+		return err
+	}
+
+	if err := write(f, class); err != nil {
+		f.Close()
+		return err
+	}
+
+	return f.Close()
+}
+
+func writeJackTokens(w io.Writer, class *jackClass) error {
+	b := bufio.NewWriter(w)
+
+	fmt.Fprintln(b, "<tokens>")
+
+	for _, t := range class.tokens {
+		fmt.Fprintln(b, jackTerminal(t))
+	}
+
+	fmt.Fprintln(b, "</tokens>")
+
+	return b.Flush()
+}
+
+func jackTerminal(t jackToken) string {
+	tag := jackTokenTags[t.kind]
+
+	return fmt.Sprintf("<%s> %s </%s>", tag, jackXMLEscapes.Replace(t.value), tag)
+}
+
+func writeJackJSON(w io.Writer, class *jackClass) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+
+	return enc.Encode(class)
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// Parse tree
+////////////////////////////////////////////////////////////////////////////////
+
+type jackTreeWriter struct {
+	b      *bufio.Writer
+	tokens []jackToken
+	depth  int
+}
+
+func writeJackTree(w io.Writer, class *jackClass) error {
+	t := jackTreeWriter{b: bufio.NewWriter(w), tokens: class.tokens}
+	t.class(class)
+
+	return t.b.Flush()
+}
+
+func (t *jackTreeWriter) line(s string) {
+	fmt.Fprintf(t.b, "%s%s\n", strings.Repeat("  ", t.depth), s)
+}
+
+func (t *jackTreeWriter) open(tag string) {
+	t.line("<" + tag + ">")
+	t.depth++
+}
+
+func (t *jackTreeWriter) close(tag string) {
+	t.depth--
+	t.line("</" + tag + ">")
+}
+
+// Writes the next n tokens.
+func (t *jackTreeWriter) terminals(n int) {
+	for i := 0; i < n; i++ {
+		t.line(jackTerminal(t.tokens[0]))
+		t.tokens = t.tokens[1:]
+	}
+}
+
+func (t *jackTreeWriter) class(class *jackClass) {
+	t.open("class")
+	t.terminals(3) // class Name {
+
+	for _, dec := range class.Vars {
+		t.open("classVarDec")
+		t.terminals(2 + 2*len(dec.Names)) // static type a, b ;
+		t.close("classVarDec")
+	}
+
+	for _, sub := range class.Subroutines {
+		t.subroutine(sub)
+	}
+
+	t.terminals(1)
+	t.close("class")
+}
+
+func (t *jackTreeWriter) subroutine(sub jackSubroutine) {
+	t.open("subroutineDec")
+	t.terminals(4) // function type name (
+
+	t.open("parameterList")
+	t.terminals(max(0, 3*len(sub.Params)-1)) // type a, type b
+	t.close("parameterList")
+
+	t.terminals(1)
+	t.open("subroutineBody")
+	t.terminals(1)
+
+	for _, dec := range sub.Locals {
+		t.open("varDec")
+		t.terminals(2 + 2*len(dec.Names))
+		t.close("varDec")
+	}
+
+	t.statements(sub.Body)
+	t.terminals(1)
+	t.close("subroutineBody")
+	t.close("subroutineDec")
+}
+
+func (t *jackTreeWriter) statements(statements []jackStatement) {
+	t.open("statements")
+
+	for _, s := range statements {
+		t.open(s.Kind + "Statement")
+		t.terminals(1)
+
+		switch s.Kind {
+		case "let":
+			t.target(s.Target)
+			t.terminals(1)
+			t.expression(s.Value)
+
+		case "if", "while":
+			t.terminals(1)
+			t.expression(s.Value)
+			t.terminals(2)
+			t.statements(s.Body)
+			t.terminals(1)
+
+			if s.HasElse {
+				t.terminals(2)
+				t.statements(s.Else)
+				t.terminals(1)
+			}
+
+		case "do":
+			t.call(s.Value)
+
+		case "return":
+			if s.Value != nil {
+				t.expression(s.Value)
+			}
+		}
+
+		if s.Kind != "if" && s.Kind != "while" {
+			t.terminals(1)
+		}
+
+		t.close(s.Kind + "Statement")
+	}
+
+	t.close("statements")
+}
+
+// A variable or array element isn't a term in a let.
+func (t *jackTreeWriter) target(e *jackExpr) {
+	switch e.Kind {
+	case "var":
+		t.terminals(1)
+	case "index":
+		t.terminals(2)
+		t.expression(e.Operands[0])
+		t.terminals(1)
+	default:
+		t.term(e)
+	}
+}
+
+func (t *jackTreeWriter) expression(e *jackExpr) {
+	t.open("expression")
+	t.terms(e)
+	t.close("expression")
+}
+
+// The left operand of a binary expression is everything before it.
+func (t *jackTreeWriter) terms(e *jackExpr) {
+	if e.Kind != "binary" {
+		t.term(e)
+		return
+	}
+
+	t.terms(e.Operands[0])
+	t.terminals(1)
+	t.term(e.Operands[1])
+}
+
+func (t *jackTreeWriter) term(e *jackExpr) {
+	t.open("term")
+
+	switch e.Kind {
+	case "index":
+		t.target(e)
+	case "call":
+		t.call(e)
+	case "unary":
+		t.terminals(1)
+		t.term(e.Operands[0])
+	case "group":
+		t.terminals(1)
+		t.expression(e.Operands[0])
+		t.terminals(1)
+	default:
+		t.terminals(1)
+	}
+
+	t.close("term")
+}
+
+func (t *jackTreeWriter) call(e *jackExpr) {
+	if e.Object != "" {
+		t.terminals(4) // Object . name (
+	} else {
+		t.terminals(2)
+	}
+
+	t.open("expressionList")
+
+	for i, arg := range e.Operands {
+		if i > 0 {
+			t.terminals(1)
+		}
+
+		t.expression(arg)
+	}
+
+	t.close("expressionList")
+	t.terminals(1)
+}
@@ -0,0 +1,111 @@
+package components
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// ArrayTest's Main.jack is the course's, Box is ours and covers the
+// rest of the grammar.  The .xml files for both are NOT the course's
+// reference files (which aren't in this tree), they were written by
+// hand in the same layout, so agreeing with them doesn't prove the
+// output matches the course's tools.  Swap in the course's
+// ArrayTest/Main.xml and MainT.xml to check that.
+func TestJackXML(t *testing.T) {
+	for _, name := range []string{"ArrayTest/Main", "Box/Box"} {
+		path := filepath.Join("testdata/jack", name)
+		prog, err := LoadJackProgram(path + ".jack")
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for _, o := range []struct {
+			suffix string
+			write  func(*strings.Builder) error
+		}{
+			{"T.xml", func(b *strings.Builder) error { return writeJackTokens(b, prog.classes[0]) }},
+			{".xml", func(b *strings.Builder) error { return writeJackTree(b, prog.classes[0]) }},
+		} {
+			expected, err := ioutil.ReadFile(path + o.suffix)
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var actual strings.Builder
+
+			if err := o.write(&actual); err != nil {
+				t.Fatal(err)
+			}
+
+			compareJackXML(t, path+o.suffix, string(expected), actual.String())
+		}
+	}
+}
+
+// Line by line, ignoring white space, the same as the course's
+// TextComparer.
+func compareJackXML(t *testing.T, name, expected, actual string) {
+	strip := strings.NewReplacer(" ", "", "\t", "", "\r", "")
+	e := strings.Split(strings.TrimSpace(strip.Replace(expected)), "\n")
+	a := strings.Split(strings.TrimSpace(strip.Replace(actual)), "\n")
+
+	for i := 0; i < min(len(e), len(a)); i++ {
+		if e[i] != a[i] {
+			t.Fatalf("%s, line %d: expected %s, got %s", name, i+1, e[i], a[i])
+		}
+	}
+
+	if len(e) != len(a) {
+		t.Fatalf("%s: expected %d lines, got %d", name, len(e), len(a))
+	}
+}
+
+func TestJackOutputs(t *testing.T) {
+	dir, err := ioutil.TempDir("", "n2t-jack")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.RemoveAll(dir)
+
+	prog, err := LoadJackProgram("testdata/jack/Box")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	written, err := prog.WriteOutputs(dir, JackOutputs{Tree: true, JSON: true})
+
+	if err != nil || len(written) != 2 || filepath.Base(written[0]) != "Box.xml" || filepath.Base(written[1]) != "Box.json" {
+		t.Fatalf("Expected Box.xml and Box.json to be written, got %v, %v", written, err)
+	}
+
+	b, err := ioutil.ReadFile(written[1])
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var class struct {
+		Name        string
+		Subroutines []struct {
+			Name string
+			Body []struct{ Kind string }
+		}
+	}
+
+	if err := json.Unmarshal(b, &class); err != nil {
+		t.Fatal(err)
+	}
+
+	if class.Name != "Box" || len(class.Subroutines) != 4 || class.Subroutines[1].Body[2].Kind != "if" {
+		t.Errorf("Unexpected JSON: %s", b)
+	}
+}
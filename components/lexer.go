@@ -1,6 +1,8 @@
 package components
 
 import (
+	"context"
+	"fmt"
 	"strings"
 	"unicode/utf8"
 )
@@ -19,28 +21,50 @@ type lexer struct {
 	width   int    // width of last rune that was read
 	lineNum int    // current source line number
 	output chan asmLexeme
+	ctx     context.Context // stops the lexer early once done
 }
 
 // Requires an initial state function to run.
-func newLexer(input string) *lexer {
+func newLexer(ctx context.Context, input string) *lexer {
 	return &lexer{
 		input:   input,
 		lineNum: 1,
 		output: make(chan asmLexeme),
+		ctx:     ctx,
 	}
 }
 
-// Kick off the lexing process.
+// Kick off the lexing process.  The output channel is closed once
+// there's nothing left to do, the context is done, or a state function
+// panics, in which case the panic is sent on as an error.
 func (l *lexer) Run(init stateFunction) {
 	go func() {
-		state := init(l)
-		
-		for state != nil {
+		defer close(l.output)
+
+		defer func() {
+			if r := recover(); r != nil {
+				l.send(asmLexeme{
+					lineNum:     l.lineNum,
+					instruction: asmERROR,
+					value:       fmt.Sprintf("Lexer panic, line %d: %v", l.lineNum, r),
+				})
+			}
+		}()
+
+		for state := init; state != nil && l.ctx.Err() == nil; {
 			state = state(l)
 		}
 	}()
 }
 
+// Sends lex, unless nobody's going to read it.
+func (l *lexer) send(lex asmLexeme) {
+	select {
+	case l.output <- lex:
+	case <-l.ctx.Done():
+	}
+}
+
 func (l* lexer) emit(i asmInstruction) {
 	var value string
 
@@ -61,7 +85,7 @@ func (l* lexer) emit(i asmInstruction) {
 		value:       value,
 	}
 
-	l.output <- lex
+	l.send(lex)
 
 	if i == asmEOL {
 		l.lineNum++
@@ -88,11 +112,7 @@ func (l *lexer) atEOL() bool {
 // True if sitting at the beginning of a comment.
 // To do - consumer provides function to determine this.
 func (l *lexer) atComment() bool {
-	if l.pos < len(l.input)-2 {
-		return "//" == l.input[l.pos:l.pos+2]
-	}
-
-	return false
+	return strings.HasPrefix(l.input[l.pos:], "//")
 }
 
 // Starting from current position, look for the next ';', '=', '@' or
@@ -120,25 +140,9 @@ func (l *lexer) nextInstance(of string) string {
 // Return the entire line (i.e. back from start to the next EOL/BOF,
 // forward toward the next EOL/EOF).
 func (l *lexer) currentLine() string {
-	var start int
+	start := strings.LastIndexAny(l.input[:l.start], "\r\n") + 1
 	end := l.nextEol()
 
-	if l.lineNum == 1 {
-		start = 0
-	} else {
-		// For linenum to be anything but 1, a EOL has to have been
-		// processed.
-		start = l.start - 1
-		for {
-			test := l.input[start : start+1]
-			if test == "\n" {
-				start++
-				break
-			}
-			start--
-		}
-	}
-
 	return l.input[start:end]
 }
 
@@ -189,11 +193,11 @@ func (l *lexer) skipChars(chars string) {
 	}
 }
 
-// Assumes at EOL
+// Assumes at EOL, which may be \r\n, \n or just \r.
 func (l *lexer) skipEol() {
 	next := l.next()
 
-	if next == "\r" {
+	if next == "\r" && l.peek() == "\n" {
 		l.skipOne()
 	}
 
@@ -1,58 +1,227 @@
 package components
 
-// HACK - internally stored as ints so I can use -1 as a flag value.
+import (
+	"fmt"
+	"strings"
+)
+
+type symbolKind int
+
+const (
+	symLabel    symbolKind = iota
+	symVariable            // address given by writeMem
+	symRegister            // R0-R15
+	symPointer             // SP, LCL, ARG, THIS and THAT
+	symConstant            // SCREEN and KBD
+)
+
+type symbol struct {
+	kind    symbolKind
+	value   asm
+	lineNum int  // where a label was defined or a variable first used, 0 if predefined
+	local   bool // a local or numeric label
+}
+
 type symbolTable struct {
-	symbols     map[string]int
+	symbols     map[string]symbol
+	order       []string // variables, in order of first use
 	initialised bool
 }
 
+// The table starts out with the predefined symbols in it, so that
+// labels can't redefine them.
 func newSymbolTable() symbolTable {
-	return symbolTable{
-		symbols: make(map[string]int),
+	st := symbolTable{
+		symbols: make(map[string]symbol),
+	}
+
+	for _, predefined := range []struct {
+		kind    symbolKind
+		symbols map[string]asm
+	}{
+		{symRegister, registers},
+		{symPointer, pointers},
+		{symConstant, constants},
+	} {
+		for name, value := range predefined.symbols {
+			st.symbols[name] = symbol{kind: predefined.kind, value: value}
+		}
 	}
+
+	return st
 }
 
 // Because we don't know the order in which variables and labels will
-// be added - parser could see @START......(START) - we're just
-// writing a flag value for all variables, in case they turn out to be
-// labels.  Easier than updating them as we go and then reshuffling
-// the variable locations.
-func (st *symbolTable) writeMem() {
+// be added - parser could see @START......(START) - anything that
+// isn't already known is added as a variable, and turned into a label
+// if its label turns up.  Once all of the labels are known, this gives
+// the variables their addresses, in the order they're first used as
+// the spec requires, from 16 up to SCREEN; any more and they'd be
+// writing over the screen (and then the keyboard).
+func (st *symbolTable) writeMem() error {
 	mem := 16
+	var err error
+
+	for _, k := range st.order {
+		sym := st.symbols[k]
+
+		if sym.kind != symVariable {
+			continue
+		}
 
-	for k, v := range st.symbols {
-		if v == -1 {
-			st.symbols[k] = mem
-			mem++
+		if mem == screenBase {
+			err = fmt.Errorf("Too many variables, %s would be at %d, the start of SCREEN", k, mem)
 		}
+
+		sym.value = asm(mem)
+		st.symbols[k] = sym
+		mem++
 	}
 
 	st.initialised = true
+
+	return err
 }
 
-// Will always know the value of a label, and will overwrite any
-// mistaken "variables" previously written (that will be -1)
-func (st *symbolTable) addLabel(s string, m asm) {
-	st.symbols[s] = int(m)
+// Labels can replace a variable of the same name (it was used before
+// the label was defined) but nothing else.
+func (st *symbolTable) addLabel(s string, m asm, lineNum int, local bool) error {
+	existing, ok := st.symbols[s]
+
+	switch {
+	case !ok || existing.kind == symVariable:
+		st.symbols[s] = symbol{kind: symLabel, value: m, lineNum: lineNum, local: local}
+		return nil
+
+	case existing.kind == symLabel:
+		return fmt.Errorf("Label defined twice, lines %d and %d: %s", existing.lineNum, lineNum, s)
+	}
+
+	return fmt.Errorf("Label is a predefined symbol, line %d: %s", lineNum, s)
 }
 
-// We may be adding a variable, in which case set it to -1
-// But if it already exists in the table, must be a label, so ignore.
-func (st *symbolTable) addVariable(s string) {
+// Anything not already in the table may be a variable.
+func (st *symbolTable) addVariable(s string, lineNum int) {
 	if _, ok := st.symbols[s]; !ok {
-		st.symbols[s] = -1
+		st.symbols[s] = symbol{kind: symVariable, lineNum: lineNum}
+		st.order = append(st.order, s)
+	}
+}
+
+// Looks up s, which is only safe for variables once writeMem has been
+// called.
+func (st *symbolTable) lookup(s string) (symbol, bool) {
+	sym, ok := st.symbols[s]
+
+	if ok && sym.kind == symVariable && !st.initialised {
+		panic("DEVELOPER ERROR - you need to call writeMem() before looking up variables.")
+	}
+
+	return sym, ok
+}
+
+// The names and values of all symbols of the given kind.
+func (st *symbolTable) ofKind(kind symbolKind) map[string]int {
+	found := make(map[string]int)
+
+	for name, sym := range st.symbols {
+		if sym.kind == kind {
+			found[name] = int(sym.value)
+		}
+	}
+
+	return found
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// Local labels.  A label starting with a '.' belongs to the global
+// label before it, so (.loop) under (MULT) is really MULT.loop, and
+// @.loop means the one under the current global label.  Numeric labels
+// (1:) can be defined any number of times, @1b refers to the closest
+// one before and @1f to the closest one after.
+////////////////////////////////////////////////////////////////////////////////
+
+type labelScope struct {
+	global  string         // the current global label
+	numeric map[string]int // how many of each numeric label have been seen
+	forward []forwardRef   // @1f etc, checked once all labels are known
+}
+
+type forwardRef struct {
+	label   string
+	index   int // which definition of label it's expecting
+	lineNum int
+}
+
+func newLabelScope() labelScope {
+	return labelScope{numeric: make(map[string]int)}
+}
+
+func isNumericLabel(s string) bool {
+	return s != "" && strings.Trim(s, digits) == ""
+}
+
+// Each definition of a numeric label gets its own name, starting with
+// a '%' so that it can't be written as a symbol (1:0 can be).
+func numericLabel(n string, i int) string {
+	return fmt.Sprintf("%%%s.%d", n, i)
+}
+
+func isLocalLabel(s string) bool {
+	return isNumericLabel(s) || strings.HasPrefix(s, ".")
+}
+
+// The full name of a label being defined.
+func (ls *labelScope) define(s string) string {
+	switch {
+	case isNumericLabel(s):
+		ls.numeric[s]++
+		return numericLabel(s, ls.numeric[s]-1)
+
+	case strings.HasPrefix(s, "."):
+		return ls.global + s
 	}
+
+	ls.global = s
+
+	return s
 }
 
-// Will return 0 if there is no matching symbol.
-func (st *symbolTable) symbolValue(s string) asm {
-	if !st.initialised {
-		panic("DEVELOPER ERROR - you need to call writeMem() before calling symbolValue().")
+// The full name of a symbol used in an A-instruction.
+func (ls *labelScope) resolve(s string, lineNum int) (string, error) {
+	if strings.HasPrefix(s, ".") {
+		return ls.global + s, nil
+	}
+
+	n, direction := s[:len(s)-1], s[len(s)-1:]
+
+	if !isNumericLabel(n) || (direction != "b" && direction != "f") {
+		return s, nil
 	}
 
-	if res, ok := st.symbols[s]; ok {
-		return asm(res)
+	seen := ls.numeric[n]
+
+	if direction == "f" {
+		ls.forward = append(ls.forward, forwardRef{n, seen, lineNum})
+		return numericLabel(n, seen), nil
+	}
+
+	if seen == 0 {
+		return s, fmt.Errorf("No %s: before line %d: @%s", n, lineNum, s)
+	}
+
+	return numericLabel(n, seen-1), nil
+}
+
+// Forward references that never found their label.
+func (ls *labelScope) check() errorList {
+	var errs errorList
+
+	for _, f := range ls.forward {
+		if ls.numeric[f.label] <= f.index {
+			errs = append(errs, fmt.Errorf("No %s: after line %d: @%sf", f.label, f.lineNum, f.label))
+		}
 	}
 
-	return asm(0)
+	return errs
 }
@@ -0,0 +1,82 @@
+package components
+
+import (
+	"strings"
+	"testing"
+)
+
+var symbolTests = []struct {
+	name     string
+	source   string
+	expected []asm // first instructions
+}{
+	{"Label at ROM 0", "(START)\nD=0\n@START\n0;JMP", []asm{cInst | 42<<6 | destD, aInst | 0}},
+	{"Label used before it's defined", "@END\n0;JMP\n(END)\n@x", []asm{aInst | 2, cInst | 42<<6 | 7, aInst | 16}},
+	{"Predefined symbols", "@R15\n@THAT\n@SCREEN\n@KBD", []asm{aInst | 15, aInst | 4, aInst | 16384, aInst | 24576}},
+	{"Variables in order of use", "@b\n@a\n@b\n@0", []asm{aInst | 16, aInst | 17, aInst | 16, aInst | 0}},
+	{"Local labels",
+		"(MULT)\n(.loop)\n@.loop\n0;JMP\n(DIV)\n@.loop\n(.loop)\n0;JMP\n@MULT.loop",
+		[]asm{aInst | 0, cInst | 42<<6 | jmpJMP, aInst | 3, cInst | 42<<6 | jmpJMP, aInst | 0}},
+	{"Numeric labels",
+		"1:\n@1f\n0;JMP\n1:\n@1b\n@1b\n1:\n@2f\n2:",
+		[]asm{aInst | 2, cInst | 42<<6 | jmpJMP, aInst | 2, aInst | 2, aInst | 5}},
+	{"Numeric labels don't clash with symbols",
+		"D=0\n(1:0)\nD=0\n1:\n@1:0\n@1b",
+		[]asm{cInst | 42<<6 | destD, cInst | 42<<6 | destD, aInst | 1, aInst | 2}},
+}
+
+func TestSymbols(t *testing.T) {
+	for _, tst := range symbolTests {
+		prog, err := AssembleProgram(tst.source)
+
+		if err != nil {
+			t.Errorf("%s: %s", tst.name, err)
+			continue
+		}
+
+		for i, expected := range tst.expected {
+			if i >= len(prog.words) || prog.words[i] != expected {
+				t.Errorf("%s: expected %v, got %v", tst.name, tst.expected, prog.words)
+				break
+			}
+		}
+	}
+}
+
+var symbolErrors = []struct {
+	source   string
+	expected string
+}{
+	{"(LOOP)\nD=0\n(LOOP)\n@LOOP", "Label defined twice, lines 1 and 3: LOOP"},
+	{"(SP)\n@SP", "Label is a predefined symbol, line 1: SP"},
+	{"(R3)\n@R3", "Label is a predefined symbol, line 1: R3"},
+	{"(A)\n(.x)\n(B)\n(A.x)", "Label defined twice, lines 2 and 4: A.x"},
+	{"D=0\n@1b\n1:", "No 1: before line 2: @1b"},
+	{"1:\n@1f\nD=0", "No 1: after line 2: @1f"},
+}
+
+func TestSymbolErrors(t *testing.T) {
+	for _, tst := range symbolErrors {
+		_, err := AssembleProgram(tst.source)
+
+		if err == nil || !strings.Contains(err.Error(), tst.expected) {
+			t.Errorf("%q: expected %q, got %v", tst.source, tst.expected, err)
+		}
+	}
+}
+
+func TestSymbolLookup(t *testing.T) {
+	st := newSymbolTable()
+
+	if sym, ok := st.lookup("SP"); !ok || sym.kind != symPointer || sym.value != 0 {
+		t.Errorf("Expected SP to be a pointer to 0, got %+v", sym)
+	}
+
+	if sym, ok := st.lookup("R0"); !ok || sym.kind != symRegister || sym.value != 0 {
+		t.Errorf("Expected R0 to be a register at 0, got %+v", sym)
+	}
+
+	if _, ok := st.lookup("nothing"); ok {
+		t.Error("Expected an unknown symbol not to be found")
+	}
+}
@@ -0,0 +1,23 @@
+package components
+
+import (
+	"runtime"
+	"testing"
+	"time"
+)
+
+// Fails if goroutines started by f are still around shortly after it's
+// returned.
+func checkGoroutines(t *testing.T, f func()) {
+	before := runtime.NumGoroutine()
+
+	f()
+
+	for wait := time.Millisecond; runtime.NumGoroutine() > before; wait *= 2 {
+		if wait > time.Second {
+			t.Fatalf("%d goroutines left running", runtime.NumGoroutine()-before)
+		}
+
+		time.Sleep(wait)
+	}
+}
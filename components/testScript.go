@@ -0,0 +1,792 @@
+/*
+ Interpreter for the course's test scripts (.tst), which drive a
+ simulator, write selected values to an output file (.out) and compare
+ each line against an expected output file (.cmp).
+*/
+
+package components
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// scriptTarget is whatever the test script is driving; the CPU
+// emulator, chip simulator or VM emulator.  Variables are things like RAM[16], PC or a chip's pins.
+type scriptTarget interface {
+	load(name string) error
+	get(variable string) (int, error)
+	set(variable string, value int) error
+	tick() error
+	tock() error
+	eval() error
+}
+
+// scriptCommander is implemented by targets with commands of their
+// own, e.g. the VM emulator's vmstep.  Returns false if the command
+// isn't one of them.
+type scriptCommander interface {
+	command(name string, args []string) (bool, error)
+}
+
+// RunCPUScript runs a test script against the CPU emulator.  Any
+// file names in the script are relative to the script's directory.
+func RunCPUScript(path string) error {
+	return runTestScript(path, &cpuTarget{NewHackComputer()})
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// Script syntax; a list of commands separated by ',' or ';', where
+// repeat and while commands have a block of commands in braces.
+////////////////////////////////////////////////////////////////////////////////
+
+type scriptCommand struct {
+	words   []string
+	lineNum int
+	body    []scriptCommand // repeat and while only
+}
+
+type scriptToken struct {
+	value   string
+	lineNum int
+}
+
+// Splits source into words, braces and separators, dropping comments.
+// Quoted strings (used by echo) are kept as a single token, quotes
+// and all.
+func tokeniseScript(source string) ([]scriptToken, error) {
+	var tokens []scriptToken
+	lineNum := 1
+	i := 0
+
+	for i < len(source) {
+		c := source[i]
+
+		switch {
+		case c == '\n':
+			lineNum++
+			i++
+
+		case unicode.IsSpace(rune(c)):
+			i++
+
+		case strings.HasPrefix(source[i:], "//"):
+			end := strings.IndexByte(source[i:], '\n')
+			if end == -1 {
+				end = len(source) - i
+			}
+			i += end
+
+		case strings.HasPrefix(source[i:], "/*"):
+			end := strings.Index(source[i:], "*/")
+			if end == -1 {
+				return nil, fmt.Errorf("Unterminated comment, line %d", lineNum)
+			}
+			lineNum += strings.Count(source[i:i+end], "\n")
+			i += end + 2
+
+		case strings.ContainsRune("{},;", rune(c)):
+			tokens = append(tokens, scriptToken{string(c), lineNum})
+			i++
+
+		case c == '"':
+			end := strings.IndexByte(source[i+1:], '"')
+			if end == -1 {
+				return nil, fmt.Errorf("Unterminated string, line %d", lineNum)
+			}
+			tokens = append(tokens, scriptToken{source[i : i+end+2], lineNum})
+			i += end + 2
+
+		default:
+			start := i
+			for i < len(source) &&
+				!unicode.IsSpace(rune(source[i])) &&
+				!strings.ContainsRune("{},;", rune(source[i])) {
+				i++
+			}
+			tokens = append(tokens, scriptToken{source[start:i], lineNum})
+		}
+	}
+
+	return tokens, nil
+}
+
+// Parses commands until either the end of tokens or a closing brace,
+// returning the commands, the number of tokens consumed and whether
+// it stopped at a brace.
+func parseScript(tokens []scriptToken) ([]scriptCommand, int, bool, error) {
+	var commands []scriptCommand
+	var current scriptCommand
+	i := 0
+
+	for i < len(tokens) {
+		t := tokens[i]
+		i++
+
+		switch t.value {
+		case ",", ";":
+			if len(current.words) > 0 {
+				commands = append(commands, current)
+			}
+			current = scriptCommand{}
+
+		case "{":
+			if len(current.words) == 0 ||
+				(current.words[0] != "repeat" && current.words[0] != "while") {
+				return nil, 0, false, fmt.Errorf("Unexpected '{', line %d", t.lineNum)
+			}
+
+			body, n, closed, err := parseScript(tokens[i:])
+
+			if err != nil {
+				return nil, 0, false, err
+			}
+
+			if !closed {
+				return nil, 0, false, fmt.Errorf("Missing '}' for block on line %d", current.lineNum)
+			}
+
+			i += n
+
+			current.body = body
+			commands = append(commands, current)
+			current = scriptCommand{}
+
+		case "}":
+			if len(current.words) > 0 {
+				commands = append(commands, current)
+			}
+			return commands, i, true, nil
+
+		default:
+			if len(current.words) == 0 {
+				current.lineNum = t.lineNum
+			}
+			current.words = append(current.words, t.value)
+		}
+	}
+
+	if len(current.words) > 0 {
+		commands = append(commands, current)
+	}
+
+	return commands, i, false, nil
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// Running a script.
+////////////////////////////////////////////////////////////////////////////////
+
+type testScript struct {
+	dir      string
+	target   scriptTarget
+	time     int
+	halfway  bool // between a tick and a tock
+	columns  []outputColumn
+	out      *os.File
+	cmp      []string
+	outLine  int
+	deadline time.Time // zero for no time limit
+}
+
+func runTestScript(path string, target scriptTarget) error {
+	return runTestScriptUntil(path, target, time.Time{})
+}
+
+// Gives up with an error if the script is still running at deadline,
+// so a program that never finishes can't keep a while loop going
+// forever.
+func runTestScriptUntil(path string, target scriptTarget, deadline time.Time) error {
+	b, err := ioutil.ReadFile(path)
+
+	if err != nil {
+		return err
+	}
+
+	tokens, err := tokeniseScript(string(b))
+
+	if err != nil {
+		return err
+	}
+
+	commands, n, closed, err := parseScript(tokens)
+
+	if err != nil {
+		return err
+	}
+
+	if closed {
+		return fmt.Errorf("Unexpected '}', line %d", tokens[n-1].lineNum)
+	}
+
+	ts := testScript{
+		dir:      filepath.Dir(path),
+		target:   target,
+		deadline: deadline,
+	}
+
+	defer ts.closeOutput()
+
+	return ts.runAll(commands)
+}
+
+func (ts *testScript) runAll(commands []scriptCommand) error {
+	for _, c := range commands {
+		if err := ts.run(c); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (ts *testScript) run(c scriptCommand) error {
+	if !ts.deadline.IsZero() && time.Now().After(ts.deadline) {
+		return fmt.Errorf("Timed out (line %d: %s)", c.lineNum, strings.Join(c.words, " "))
+	}
+
+	err := ts.dispatch(c)
+
+	if err != nil {
+		return fmt.Errorf("%s (line %d: %s)", err, c.lineNum, strings.Join(c.words, " "))
+	}
+
+	return nil
+}
+
+func (ts *testScript) dispatch(c scriptCommand) error {
+	args := c.words[1:]
+
+	switch c.words[0] {
+	case "load":
+		if len(args) > 1 {
+			return errors.New("load expects a file name")
+		}
+		// on its own, load means the script's directory
+		if len(args) == 0 {
+			return ts.target.load(ts.dir)
+		}
+		return ts.target.load(ts.path(args[0]))
+
+	case "output-file":
+		if len(args) != 1 {
+			return errors.New("output-file expects a file name")
+		}
+		return ts.openOutput(args[0])
+
+	case "compare-to":
+		if len(args) != 1 {
+			return errors.New("compare-to expects a file name")
+		}
+		return ts.openCompare(args[0])
+
+	case "output-list":
+		return ts.outputList(args)
+
+	case "output":
+		return ts.output()
+
+	case "set":
+		if len(args) != 2 {
+			return errors.New("set expects a variable and a value")
+		}
+		v, err := parseScriptValue(args[1])
+		if err != nil {
+			return err
+		}
+		return ts.target.set(args[0], v)
+
+	case "eval":
+		return ts.target.eval()
+
+	case "tick":
+		ts.halfway = true
+		return ts.target.tick()
+
+	case "tock":
+		ts.halfway = false
+		ts.time++
+		return ts.target.tock()
+
+	case "ticktock":
+		if err := ts.dispatch(scriptCommand{words: []string{"tick"}}); err != nil {
+			return err
+		}
+		return ts.dispatch(scriptCommand{words: []string{"tock"}})
+
+	case "repeat":
+		return ts.repeat(c)
+
+	case "while":
+		return ts.while(c)
+
+	case "echo", "clear-echo", "breakpoint", "clear-breakpoints":
+		// Only of interest to the GUI tools.
+		return nil
+
+	default:
+		if commander, ok := ts.target.(scriptCommander); ok {
+			if handled, err := commander.command(c.words[0], args); handled {
+				return err
+			}
+		}
+
+		return fmt.Errorf("Unrecognised command: %s", c.words[0])
+	}
+}
+
+func (ts *testScript) repeat(c scriptCommand) error {
+	if len(c.words) != 2 {
+		return errors.New("repeat without a count cannot be run headlessly")
+	}
+
+	n, err := strconv.Atoi(c.words[1])
+
+	if err != nil || n < 0 {
+		return fmt.Errorf("Invalid repeat count: %s", c.words[1])
+	}
+
+	for i := 0; i < n; i++ {
+		if err := ts.runAll(c.body); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (ts *testScript) while(c scriptCommand) error {
+	if len(c.words) != 4 {
+		return errors.New("while expects a condition of the form 'a op b'")
+	}
+
+	for {
+		ok, err := ts.condition(c.words[1], c.words[2], c.words[3])
+
+		if err != nil || !ok {
+			return err
+		}
+
+		if err := ts.runAll(c.body); err != nil {
+			return err
+		}
+	}
+}
+
+func (ts *testScript) condition(lhs, op, rhs string) (bool, error) {
+	l, err := ts.operand(lhs)
+
+	if err != nil {
+		return false, err
+	}
+
+	r, err := ts.operand(rhs)
+
+	if err != nil {
+		return false, err
+	}
+
+	switch op {
+	case "=":
+		return l == r, nil
+	case "<>":
+		return l != r, nil
+	case "<":
+		return l < r, nil
+	case "<=":
+		return l <= r, nil
+	case ">":
+		return l > r, nil
+	case ">=":
+		return l >= r, nil
+	}
+
+	return false, fmt.Errorf("Unrecognised comparison: %s", op)
+}
+
+// An operand is either a literal value, or a variable.
+func (ts *testScript) operand(s string) (int, error) {
+	if v, err := parseScriptValue(s); err == nil {
+		return v, nil
+	}
+
+	if s == "time" {
+		return ts.time, nil
+	}
+
+	return ts.target.get(s)
+}
+
+// Values can be decimal, or prefixed with %B, %X or %D.
+func parseScriptValue(s string) (int, error) {
+	base := 10
+
+	switch {
+	case strings.HasPrefix(s, "%B"):
+		base = 2
+	case strings.HasPrefix(s, "%X"):
+		base = 16
+	case strings.HasPrefix(s, "%D"):
+		base = 10
+	default:
+		s = "%D" + s
+	}
+
+	v, err := strconv.ParseInt(s[2:], base, 32)
+
+	if err != nil {
+		return 0, fmt.Errorf("Invalid value: %s", s[2:])
+	}
+
+	// binary and hex values are 16 bit patterns, so may be negative
+	if base != 10 {
+		v = int64(int16(v))
+	}
+
+	return int(v), nil
+}
+
+func (ts *testScript) path(name string) string {
+	if filepath.IsAbs(name) {
+		return name
+	}
+
+	return filepath.Join(ts.dir, name)
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// Output and comparison.
+////////////////////////////////////////////////////////////////////////////////
+
+// A column in the output list, e.g. RAM[0]%D2.6.2 is the decimal value
+// of RAM[0], right aligned in a 6 character field with 2 spaces either
+// side.
+type outputColumn struct {
+	variable string
+	format   byte // one of B, D, S or X
+	padLeft  int
+	width    int
+	padRight int
+}
+
+func parseOutputColumn(s string) (outputColumn, error) {
+	i := strings.LastIndex(s, "%")
+
+	if i == -1 {
+		return outputColumn{s, 'B', 1, 16, 1}, nil
+	}
+
+	col := outputColumn{variable: s[:i]}
+	spec := s[i+1:]
+
+	if spec == "" || !strings.ContainsRune("BDSX", rune(spec[0])) {
+		return col, fmt.Errorf("Invalid output format: %s", s)
+	}
+
+	col.format = spec[0]
+	parts := strings.Split(spec[1:], ".")
+
+	if len(parts) != 3 {
+		return col, fmt.Errorf("Invalid output format: %s", s)
+	}
+
+	var nums [3]int
+
+	for j, p := range parts {
+		n, err := strconv.Atoi(p)
+
+		if err != nil || n < 0 {
+			return col, fmt.Errorf("Invalid output format: %s", s)
+		}
+
+		nums[j] = n
+	}
+
+	col.padLeft, col.width, col.padRight = nums[0], nums[1], nums[2]
+
+	return col, nil
+}
+
+func (col outputColumn) totalWidth() int {
+	return col.padLeft + col.width + col.padRight
+}
+
+// The variable's name, centered (or truncated) within the column.
+func (col outputColumn) header() string {
+	name := col.variable
+	total := col.totalWidth()
+
+	if len(name) > total {
+		return name[:total]
+	}
+
+	left := (total - len(name)) / 2
+	right := total - len(name) - left
+
+	return strings.Repeat(" ", left) + name + strings.Repeat(" ", right)
+}
+
+func (col outputColumn) value(ts *testScript) (string, error) {
+	var s string
+
+	if col.variable == "time" {
+		s = strconv.Itoa(ts.time)
+		if ts.halfway {
+			s += "+"
+		}
+	} else {
+		v, err := ts.target.get(col.variable)
+
+		if err != nil {
+			return "", err
+		}
+
+		switch col.format {
+		case 'B':
+			s = fmt.Sprintf("%016b", uint16(v))
+		case 'X':
+			s = fmt.Sprintf("%04X", uint16(v))
+		default:
+			s = strconv.Itoa(v)
+		}
+	}
+
+	// keep the least significant end of anything too wide
+	if len(s) > col.width {
+		s = s[len(s)-col.width:]
+	}
+
+	if col.format == 'S' {
+		s += strings.Repeat(" ", col.width-len(s))
+	} else {
+		s = strings.Repeat(" ", col.width-len(s)) + s
+	}
+
+	return strings.Repeat(" ", col.padLeft) + s + strings.Repeat(" ", col.padRight), nil
+}
+
+func (ts *testScript) outputList(args []string) error {
+	ts.columns = nil
+
+	for _, a := range args {
+		col, err := parseOutputColumn(a)
+
+		if err != nil {
+			return err
+		}
+
+		ts.columns = append(ts.columns, col)
+	}
+
+	var headers []string
+
+	for _, col := range ts.columns {
+		headers = append(headers, col.header())
+	}
+
+	return ts.writeLine(headers)
+}
+
+func (ts *testScript) output() error {
+	var values []string
+
+	for _, col := range ts.columns {
+		v, err := col.value(ts)
+
+		if err != nil {
+			return err
+		}
+
+		values = append(values, v)
+	}
+
+	return ts.writeLine(values)
+}
+
+// Writes a line of output, and if there's a compare file, checks it
+// against the matching line.
+func (ts *testScript) writeLine(fields []string) error {
+	line := "|" + strings.Join(fields, "|") + "|"
+	ts.outLine++
+
+	if ts.out != nil {
+		fmt.Fprintln(ts.out, line)
+	}
+
+	if ts.cmp == nil {
+		return nil
+	}
+
+	if ts.outLine > len(ts.cmp) {
+		return fmt.Errorf("Comparison failure at line %d: no more lines in compare file, got %q", ts.outLine, line)
+	}
+
+	expected := ts.cmp[ts.outLine-1]
+
+	if !outputMatches(expected, line) {
+		return fmt.Errorf("Comparison failure at line %d: expected %q, got %q", ts.outLine, expected, line)
+	}
+
+	return nil
+}
+
+// A '*' in the compare file matches anything.
+func outputMatches(expected, actual string) bool {
+	if len(expected) != len(actual) {
+		return false
+	}
+
+	for i := range expected {
+		if expected[i] != '*' && expected[i] != actual[i] {
+			return false
+		}
+	}
+
+	return true
+}
+
+func (ts *testScript) openOutput(name string) error {
+	ts.closeOutput()
+
+	out, err := os.Create(ts.path(name))
+
+	if err != nil {
+		return err
+	}
+
+	ts.out = out
+	ts.outLine = 0
+
+	return nil
+}
+
+func (ts *testScript) closeOutput() {
+	if ts.out != nil {
+		ts.out.Close()
+		ts.out = nil
+	}
+}
+
+func (ts *testScript) openCompare(name string) error {
+	b, err := ioutil.ReadFile(ts.path(name))
+
+	if err != nil {
+		return err
+	}
+
+	text := strings.Replace(string(b), "\r\n", "\n", -1)
+	ts.cmp = strings.Split(strings.TrimRight(text, "\n"), "\n")
+
+	for i := range ts.cmp {
+		ts.cmp[i] = strings.TrimRight(ts.cmp[i], " \t")
+	}
+
+	return nil
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// The CPU emulator as a script target.  A tick executes the current
+// instruction, and tock does nothing.
+////////////////////////////////////////////////////////////////////////////////
+
+type cpuTarget struct {
+	*HackComputer
+}
+
+func (t *cpuTarget) load(name string) error {
+	return t.LoadFile(name)
+}
+
+func (t *cpuTarget) tick() error {
+	t.Step()
+	return nil
+}
+
+func (t *cpuTarget) tock() error {
+	return nil
+}
+
+func (t *cpuTarget) eval() error {
+	return nil
+}
+
+func (t *cpuTarget) get(variable string) (int, error) {
+	switch variable {
+	case "A":
+		return int(t.A), nil
+	case "D":
+		return int(t.D), nil
+	case "PC":
+		return int(t.PC), nil
+	}
+
+	mem, addr, err := t.memory(variable)
+
+	if err != nil {
+		return 0, err
+	}
+
+	if mem == "ROM" {
+		return int(int16(t.ROM[addr])), nil
+	}
+
+	return int(t.RAM[addr]), nil
+}
+
+func (t *cpuTarget) set(variable string, value int) error {
+	switch variable {
+	case "A":
+		t.A = int16(value)
+		return nil
+	case "D":
+		t.D = int16(value)
+		return nil
+	case "PC":
+		t.PC = uint16(value) % romSize
+		return nil
+	}
+
+	mem, addr, err := t.memory(variable)
+
+	if err != nil {
+		return err
+	}
+
+	if mem == "ROM" {
+		t.ROM[addr] = asm(value)
+	} else {
+		t.RAM[addr] = int16(value)
+	}
+
+	return nil
+}
+
+// Splits RAM[123] or ROM[123] into the memory name and address.
+func (t *cpuTarget) memory(variable string) (string, int, error) {
+	open := strings.Index(variable, "[")
+
+	if open == -1 || !strings.HasSuffix(variable, "]") {
+		return "", 0, fmt.Errorf("Unknown variable: %s", variable)
+	}
+
+	mem := variable[:open]
+
+	if mem != "RAM" && mem != "ROM" {
+		return "", 0, fmt.Errorf("Unknown variable: %s", variable)
+	}
+
+	addr, err := strconv.Atoi(variable[open+1 : len(variable)-1])
+
+	if err != nil || addr < 0 || addr >= ramSize {
+		return "", 0, fmt.Errorf("Invalid address: %s", variable)
+	}
+
+	return mem, addr, nil
+}
@@ -0,0 +1,65 @@
+package components
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestMaxScript(t *testing.T) {
+	if err := RunCPUScript("testdata/Max.tst"); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestScriptReportsMismatch(t *testing.T) {
+	err := RunCPUScript("testdata/MaxWrong.tst")
+
+	if err == nil {
+		t.Fatal("Expected a comparison failure.")
+	}
+
+	if !strings.Contains(err.Error(), "line 3") {
+		t.Errorf("Expected failure on line 3 of the compare file, got: %s", err)
+	}
+}
+
+var columnTests = []struct {
+	column   string
+	value    int
+	header   string
+	expected string
+}{
+	{"RAM[0]%D2.6.2", 3, "  RAM[0]  ", "       3  "},
+	{"RAM[0]%D2.6.2", -1, "  RAM[0]  ", "      -1  "},
+	{"A%B1.16.1", 5, "        A         ", " 0000000000000101 "},
+	{"A%B1.16.1", -1, "        A         ", " 1111111111111111 "},
+	{"D%X1.4.1", 255, "  D   ", " 00FF "},
+	{"RAM[0]%D0.3.0", 23456, "RAM", "456"},
+}
+
+func TestOutputColumns(t *testing.T) {
+	for _, tst := range columnTests {
+		col, err := parseOutputColumn(tst.column)
+
+		if err != nil {
+			t.Errorf("%s: %s", tst.column, err)
+			continue
+		}
+
+		if h := col.header(); h != tst.header {
+			t.Errorf("%s: expected header %q, got %q", tst.column, tst.header, h)
+		}
+
+		c := NewHackComputer()
+		c.A, c.D, c.RAM[0] = int16(tst.value), int16(tst.value), int16(tst.value)
+		ts := testScript{target: &cpuTarget{c}}
+
+		v, err := col.value(&ts)
+
+		if err != nil {
+			t.Errorf("%s: %s", tst.column, err)
+		} else if v != tst.expected {
+			t.Errorf("%s: expected %q, got %q", tst.column, tst.expected, v)
+		}
+	}
+}
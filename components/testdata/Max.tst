@@ -0,0 +1,21 @@
+// Runs Max.asm for a couple of pairs of inputs.
+
+load Max.asm,
+output-file Max.out,
+compare-to Max.cmp,
+output-list RAM[0]%D2.6.2 RAM[1]%D2.6.2 RAM[2]%D2.6.2;
+
+set RAM[0] 3,
+set RAM[1] 5;
+repeat 14 {
+  ticktock;
+}
+output;
+
+set PC 0,
+set RAM[0] 23456,
+set RAM[1] %X0C;
+repeat 14 {
+  ticktock;
+}
+output;
@@ -0,0 +1,21 @@
+// Computes RAM[2] = RAM[0] * RAM[1], by adding RAM[0] to RAM[2]
+// RAM[1] times, counting down in RAM[1].
+
+@R2
+M=0
+(LOOP)
+@R1
+D=M
+@END
+D;JEQ
+@R0
+D=M
+@R2
+M=D+M
+@R1
+M=M-1
+@LOOP
+0;JMP
+(END)
+@END
+0;JMP
@@ -0,0 +1,12 @@
+load SimpleAdd.vm,
+output-file SimpleAdd.out,
+compare-to SimpleAdd.cmp,
+output-list RAM[0]%D2.6.2 RAM[256]%D2.6.2;
+
+set sp 256;
+
+repeat 3 {
+  vmstep;
+}
+
+output;
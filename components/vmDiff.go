@@ -0,0 +1,168 @@
+/*
+ Differential testing of VM translation; a VM program is run both in
+ the VM interpreter and, after translation and assembly, in the CPU
+ emulator, and the resulting RAM compared.
+*/
+
+package components
+
+import "fmt"
+
+// VMDiffResult is the outcome of running a VM program both ways.
+type VMDiffResult struct {
+	Commands   int  // VM commands executed
+	Cycles     int  // CPU cycles executed
+	VMHalted   bool // false if it hit the command limit
+	CPUHalted  bool // false if it hit the cycle limit
+	Divergence string
+}
+
+// Same is true if both runs halted and ended up with the same RAM.
+func (r VMDiffResult) Same() bool {
+	return r.Divergence == ""
+}
+
+func (r VMDiffResult) String() string {
+	status := "Same"
+
+	if !r.Same() {
+		status = "DIVERGED: " + r.Divergence
+	}
+
+	return fmt.Sprintf("%s (%d VM commands, %d CPU cycles)", status, r.Commands, r.Cycles)
+}
+
+// Programs without an entry point aren't bootstrapped, so both sides are
+// started with the same segments as the course's chapter 7 tests.
+var vmDiffStart = map[int]int16{
+	vmSP:   256,
+	vmLCL:  300,
+	vmARG:  400,
+	vmTHIS: 3000,
+	vmTHAT: 3010,
+}
+
+// DiffVM runs prog in the VM interpreter for up to maxCommands and
+// its translation (by TranslateVM or TranslateVMCompact) in the CPU
+// emulator for up to maxCycles, then
+// compares the registers, temp, statics, the stack (other than
+// return addresses, which the interpreter holds as command indexes),
+// the heap and the screen, reporting the first difference.
+func DiffVM(prog *VMProgram, translate func(*VMProgram) string, maxCommands, maxCycles int) (VMDiffResult, error) {
+	var result VMDiffResult
+
+	for _, c := range prog.commands {
+		if c.op == vmCALL && c.target == -1 {
+			return result, fmt.Errorf("%s: %s isn't defined, the OS has to be loaded as .vm files to be translated", c, c.name)
+		}
+	}
+
+	asm, err := AssembleProgram(translate(prog))
+
+	if err != nil {
+		return result, fmt.Errorf("Assembling the translation: %s", err)
+	}
+
+	vm := NewVMachine(prog)
+	cpu := NewHackComputer()
+	cpu.LoadProgram(asm)
+
+	if prog.entryPoint() == "" {
+		for addr, v := range vmDiffStart {
+			vm.RAM[addr] = v
+			cpu.RAM[addr] = v
+		}
+	}
+
+	result.Commands = vm.Run(maxCommands)
+	result.Cycles = cpu.Run(maxCycles)
+	result.VMHalted = vm.Halted()
+	result.CPUHalted = cpu.Halted()
+
+	if vm.Err() != nil {
+		return result, vm.Err()
+	}
+
+	switch {
+	case result.VMHalted && !result.CPUHalted:
+		result.Divergence = fmt.Sprintf("VM halted, assembly still running after %d cycles", maxCycles)
+	case !result.VMHalted && result.CPUHalted:
+		result.Divergence = fmt.Sprintf("assembly halted, VM still running after %d commands", maxCommands)
+	case !result.VMHalted && !result.CPUHalted:
+		result.Divergence = "neither halted"
+	default:
+		result.Divergence = compareVMState(vm, cpu, asm)
+	}
+
+	return result, nil
+}
+
+func compareVMState(vm *VMachine, cpu *HackComputer, asm *Program) string {
+	diff := func(name string, vmAddr, cpuAddr int) string {
+		if v, c := vm.RAM[vmAddr], cpu.RAM[cpuAddr]; v != c {
+			return fmt.Sprintf("%s: VM %d, assembly %d", name, v, c)
+		}
+		return ""
+	}
+
+	registers := []string{"SP", "LCL", "ARG", "THIS", "THAT"}
+
+	for addr := vmSP; addr < vmTemp+8; addr++ {
+		name := fmt.Sprintf("temp %d", addr-vmTemp)
+
+		if addr < vmTemp {
+			name = registers[addr]
+		}
+
+		if d := diff(name, addr, addr); d != "" {
+			return d
+		}
+	}
+
+	// statics are compared by name, it's up to the assembler where they
+	// end up
+	for _, name := range vm.program.statics {
+		cpuAddr, ok := asm.Variables[name]
+
+		if !ok {
+			return fmt.Sprintf("static %s missing from the assembly", name)
+		}
+
+		if d := diff("static "+name, vm.statics[name], cpuAddr); d != "" {
+			return d
+		}
+	}
+
+	returnAddresses := make(map[int]bool)
+
+	for _, f := range vm.CallStack() {
+		returnAddresses[f.Frame] = true
+	}
+
+	for addr := vmStack; addr < int(vm.RAM[vmSP]) && addr < vmHeap; addr++ {
+		if returnAddresses[addr] {
+			continue
+		}
+
+		if d := diff(fmt.Sprintf("stack RAM[%d]", addr), addr, addr); d != "" {
+			return d
+		}
+	}
+
+	for addr := vmHeap; addr < screenBase; addr++ {
+		if d := diff(fmt.Sprintf("heap RAM[%d]", addr), addr, addr); d != "" {
+			return d
+		}
+	}
+
+	for addr := screenBase; addr < kbdAddress; addr++ {
+		offset := addr - screenBase
+		name := fmt.Sprintf("screen RAM[%d] (row %d, column %d)", addr, offset/screenRowWords, (offset%screenRowWords)*16)
+
+		if d := diff(name, addr, addr); d != "" {
+			return d
+		}
+	}
+
+	return ""
+}
@@ -0,0 +1,124 @@
+package components
+
+import "testing"
+
+var vmTranslations = []struct {
+	name      string
+	translate func(*VMProgram) string
+}{
+	{"plain", TranslateVM},
+	{"compact", TranslateVMCompact},
+}
+
+func TestVMDiffSame(t *testing.T) {
+	prog, err := LoadVMProgram("testdata/vm/Fib")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tr := range vmTranslations {
+		result, err := DiffVM(prog, tr.translate, 100000, 1000000)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !result.Same() {
+			t.Errorf("%s: expected the same results, got %s", tr.name, result)
+		}
+	}
+}
+
+var vmDiffs = []struct {
+	source   string
+	expected string
+}{
+	// the standard translation of gt computes x-y, which overflows
+	{"push constant 32767\nneg\npush constant 1000\ngt\nlabel END\ngoto END",
+		"stack RAM[256]: VM 0, assembly -1"},
+	{"push constant 1\nlabel END\ngoto END",
+		""},
+	{`function Test.f 5
+push constant 0
+push constant 1
+push constant 7
+eq
+push constant 3
+push constant 7
+lt
+push constant 7
+push constant 3
+gt
+pop local 4
+pop local 3
+pop local 0
+pop temp 2
+pop static 1
+push constant 3000
+pop pointer 0
+push constant 3010
+pop pointer 1
+push local 3
+pop this 2
+push local 4
+pop that 5
+push this 2
+push that 5
+add
+push argument 0
+add
+return
+function Sys.init 0
+push constant 40
+call Test.f 1
+label END
+goto END`,
+		""},
+}
+
+func TestVMDiffDivergence(t *testing.T) {
+	for _, test := range vmDiffs {
+		prog, err := ParseVM([]string{"Test"}, map[string]string{"Test": test.source})
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for _, tr := range vmTranslations {
+			result, err := DiffVM(prog, tr.translate, 1000, 10000)
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if result.Divergence != test.expected {
+				t.Errorf("%s %q: expected %q, got %q", tr.name, test.source, test.expected, result.Divergence)
+			}
+		}
+	}
+}
+
+func TestVMCompactSize(t *testing.T) {
+	prog, err := LoadVMProgram("testdata/vm/Fib")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	plain, err := AssembleProgram(TranslateVM(prog))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	compact, err := AssembleProgram(TranslateVMCompact(prog))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if compact.Size() >= plain.Size() {
+		t.Errorf("Expected the compact translation to be smaller, got %d words from %d", compact.Size(), plain.Size())
+	}
+}
@@ -0,0 +1,538 @@
+/*
+ Interpreter for VM code.  RAM is laid out the same way the standard
+ VM translation lays it out (SP, LCL, ARG, THIS and THAT in RAM[0-4],
+ temp at 5, statics from 16 and the stack from 256), and call frames
+ are built on the stack in the same way, so that the state of a VM
+ program can be compared with the same program translated to
+ assembly.  The one difference is that return addresses are command
+ indexes rather than ROM addresses.
+*/
+
+package components
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+const vmSP = 0
+const vmLCL = 1
+const vmARG = 2
+const vmTHIS = 3
+const vmTHAT = 4
+const vmTemp = 5
+const vmStatic = 16
+const vmStack = 256
+const vmHeap = 2048
+
+// VMFrame is a function call in progress.
+type VMFrame struct {
+	Function string
+	ReturnTo int // index of the command to return to, -1 for the bootstrap
+	Frame    int // RAM address of the saved return address, LCL-5
+}
+
+// VMachine runs a VMProgram.
+type VMachine struct {
+	RAM       [ramSize]int16
+	PC        int // index of the next command
+	Time      int // commands executed
+	program   *VMProgram
+	statics   map[string]int // e.g. Main.0 to RAM address
+	callStack []VMFrame
+	jos       *jackOS // built in OS functions, for calls to undefined ones
+	err       error
+}
+
+// NewVMachine returns a machine ready to run prog.  If prog has a
+// Sys.init, or failing that a Main.main, it's bootstrapped the same
+// way the translator does it, otherwise it starts at the first command
+// and it's up to the caller to set up the stack pointer and segments.
+// Calls to functions that prog doesn't define go to the built in OS.
+func NewVMachine(prog *VMProgram) *VMachine {
+	vm := VMachine{
+		program: prog,
+		statics: make(map[string]int),
+	}
+
+	vm.jos = newJackOS(&vm)
+
+	for i, s := range prog.statics {
+		vm.statics[s] = vmStatic + i
+	}
+
+	if entry := prog.entryPoint(); entry != "" {
+		vm.RAM[vmSP] = vmStack
+		vm.call(entry, 0, -1)
+	}
+
+	return &vm
+}
+
+// Err returns the error that stopped the machine, if any.
+func (vm *VMachine) Err() error {
+	return vm.err
+}
+
+// Halted is true once the machine has run off the end of the program,
+// hit an error, or is sitting in a loop of the form
+//
+//	label END
+//	goto END
+func (vm *VMachine) Halted() bool {
+	if vm.err != nil || vm.PC < 0 || vm.PC >= len(vm.program.commands) {
+		return true
+	}
+
+	c := vm.program.commands[vm.PC]
+
+	return c.op == vmGOTO && (c.target == vm.PC || c.target == vm.PC-1)
+}
+
+// Run executes up to n commands, stopping early if the machine halts.
+// Returns the number of commands executed.
+func (vm *VMachine) Run(n int) int {
+	for i := 0; i < n; i++ {
+		if vm.Halted() {
+			return i
+		}
+
+		vm.Step()
+	}
+
+	return n
+}
+
+// Step executes a single command.  Errors (e.g. calling a function
+// that doesn't exist) stop the machine, see Err.
+func (vm *VMachine) Step() {
+	if vm.Halted() {
+		return
+	}
+
+	c := vm.program.commands[vm.PC]
+	vm.PC++
+	vm.Time++
+
+	if err := vm.execute(c); err != nil {
+		vm.err = fmt.Errorf("%s: %s", c, err)
+	}
+}
+
+func (vm *VMachine) execute(c vmCommand) error {
+	switch c.op {
+	case vmPUSH:
+		addr, err := vm.address(c.segment, c.arg)
+
+		if err != nil {
+			return err
+		}
+
+		if c.segment == "constant" {
+			vm.push(int16(c.arg))
+		} else {
+			vm.push(vm.RAM[addr])
+		}
+
+	case vmPOP:
+		addr, err := vm.address(c.segment, c.arg)
+
+		if err != nil {
+			return err
+		}
+
+		vm.RAM[addr] = vm.pop()
+
+	case vmADD, vmSUB, vmEQ, vmGT, vmLT, vmAND, vmOR:
+		y := vm.pop()
+		x := vm.pop()
+		vm.push(vmBinary(c.op, x, y))
+
+	case vmNEG:
+		vm.push(-vm.pop())
+
+	case vmNOT:
+		vm.push(^vm.pop())
+
+	case vmLABEL, vmFUNCTION:
+		// functions are entered via call, which sets up the locals
+
+	case vmGOTO:
+		vm.PC = c.target
+
+	case vmIFGOTO:
+		if vm.pop() != 0 {
+			vm.PC = c.target
+		}
+
+	case vmCALL:
+		if c.target == -1 {
+			return vm.jos.call(c.name, c.arg)
+		}
+
+		return vm.call(c.name, c.arg, vm.PC)
+
+	case vmRETURN:
+		return vm.ret()
+	}
+
+	return nil
+}
+
+func vmBinary(op vmOp, x, y int16) int16 {
+	switch op {
+	case vmADD:
+		return x + y
+	case vmSUB:
+		return x - y
+	case vmAND:
+		return x & y
+	case vmOR:
+		return x | y
+	case vmEQ:
+		return vmBool(x == y)
+	case vmGT:
+		return vmBool(x > y)
+	case vmLT:
+		return vmBool(x < y)
+	}
+
+	panic("DEVELOPER ERROR - not a binary operation")
+}
+
+// true is -1, i.e. all bits set
+func vmBool(b bool) int16 {
+	if b {
+		return -1
+	}
+
+	return 0
+}
+
+func (vm *VMachine) push(v int16) {
+	sp := uint16(vm.RAM[vmSP]) % ramSize
+	vm.RAM[sp] = v
+	vm.RAM[vmSP]++
+}
+
+func (vm *VMachine) pop() int16 {
+	vm.RAM[vmSP]--
+
+	return vm.RAM[uint16(vm.RAM[vmSP])%ramSize]
+}
+
+// RAM address of segment[i].  Constants don't have one.
+func (vm *VMachine) address(segment string, i int) (int, error) {
+	var addr int
+
+	switch segment {
+	case "constant":
+		return 0, nil
+	case "local":
+		addr = int(vm.RAM[vmLCL]) + i
+	case "argument":
+		addr = int(vm.RAM[vmARG]) + i
+	case "this":
+		addr = int(vm.RAM[vmTHIS]) + i
+	case "that":
+		addr = int(vm.RAM[vmTHAT]) + i
+	case "pointer":
+		addr = vmTHIS + i
+	case "temp":
+		addr = vmTemp + i
+	case "static":
+		addr = vm.statics[fmt.Sprintf("%s.%d", vm.currentFile(), i)]
+	default:
+		return 0, fmt.Errorf("Unrecognised segment: %s", segment)
+	}
+
+	if addr < 0 || addr >= ramSize {
+		return 0, fmt.Errorf("%s %d is outside of RAM (%d)", segment, i, addr)
+	}
+
+	return addr, nil
+}
+
+// The file statics belong to, that of the function being executed or,
+// outside of any function, of the last command executed.
+func (vm *VMachine) currentFile() string {
+	pc := vm.PC - 1
+
+	if len(vm.callStack) > 0 {
+		pc = vm.program.functions[vm.CurrentFunction()]
+	}
+
+	if len(vm.program.commands) == 0 {
+		return ""
+	}
+
+	return vm.program.commands[max(0, min(pc, len(vm.program.commands)-1))].file
+}
+
+// Builds the frame the same way the translated code does; return
+// address, LCL, ARG, THIS and THAT.
+func (vm *VMachine) call(function string, args int, returnTo int) error {
+	target, ok := vm.program.functions[function]
+
+	if !ok {
+		return fmt.Errorf("Function %s is not defined", function)
+	}
+
+	frame := int(vm.RAM[vmSP])
+
+	vm.push(int16(returnTo))
+	vm.push(vm.RAM[vmLCL])
+	vm.push(vm.RAM[vmARG])
+	vm.push(vm.RAM[vmTHIS])
+	vm.push(vm.RAM[vmTHAT])
+
+	vm.RAM[vmARG] = int16(frame - args)
+	vm.RAM[vmLCL] = vm.RAM[vmSP]
+
+	vm.callStack = append(vm.callStack, VMFrame{function, returnTo, frame})
+
+	for i := 0; i < vm.program.commands[target].arg; i++ {
+		vm.push(0)
+	}
+
+	vm.PC = target + 1
+
+	return nil
+}
+
+func (vm *VMachine) ret() error {
+	if len(vm.callStack) == 0 {
+		return errors.New("return with nothing to return to")
+	}
+
+	frame := int(vm.RAM[vmLCL])
+
+	if frame-5 < 0 || frame-1 >= ramSize {
+		return fmt.Errorf("LCL (%d) doesn't point at a frame", frame)
+	}
+
+	returnTo := int(vm.RAM[frame-5])
+
+	vm.RAM[uint16(vm.RAM[vmARG])%ramSize] = vm.pop()
+	vm.RAM[vmSP] = vm.RAM[vmARG] + 1
+	vm.RAM[vmTHAT] = vm.RAM[frame-1]
+	vm.RAM[vmTHIS] = vm.RAM[frame-2]
+	vm.RAM[vmARG] = vm.RAM[frame-3]
+	vm.RAM[vmLCL] = vm.RAM[frame-4]
+
+	vm.callStack = vm.callStack[:len(vm.callStack)-1]
+	vm.PC = returnTo
+
+	return nil
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// Inspection
+////////////////////////////////////////////////////////////////////////////////
+
+// CallStack returns the functions currently being executed, outermost
+// first.
+func (vm *VMachine) CallStack() []VMFrame {
+	return append([]VMFrame(nil), vm.callStack...)
+}
+
+// CurrentFunction is the name of the function being executed, or an
+// empty string if there isn't one.
+func (vm *VMachine) CurrentFunction() string {
+	if len(vm.callStack) == 0 {
+		return ""
+	}
+
+	return vm.callStack[len(vm.callStack)-1].Function
+}
+
+// Segment returns the value of segment[i] as seen by the current
+// function.
+func (vm *VMachine) Segment(segment string, i int) (int16, error) {
+	if segment == "constant" {
+		return int16(i), nil
+	}
+
+	if segment == "static" {
+		return vm.staticValue(i)
+	}
+
+	addr, err := vm.address(segment, i)
+
+	if err != nil {
+		return 0, err
+	}
+
+	return vm.RAM[addr], nil
+}
+
+// Statics belong to the same file as they do for the commands.
+func (vm *VMachine) staticValue(i int) (int16, error) {
+	addr, ok := vm.statics[fmt.Sprintf("%s.%d", vm.currentFile(), i)]
+
+	if !ok {
+		return 0, nil
+	}
+
+	return vm.RAM[addr], nil
+}
+
+// Stack returns the contents of the working stack of the current
+// function, bottom first.
+func (vm *VMachine) Stack() []int16 {
+	bottom := vmStack
+
+	if len(vm.callStack) > 0 {
+		bottom = int(vm.RAM[vmLCL])
+		bottom += vm.program.commands[vm.program.functions[vm.CurrentFunction()]].arg
+	}
+
+	top := int(vm.RAM[vmSP])
+
+	if bottom < 0 || top < bottom || top > ramSize {
+		return nil
+	}
+
+	return append([]int16(nil), vm.RAM[bottom:top]...)
+}
+
+// Command returns the source of the next command to execute, with
+// its file and line.
+func (vm *VMachine) Command() string {
+	if vm.PC < 0 || vm.PC >= len(vm.program.commands) {
+		return "(end of program)"
+	}
+
+	return vm.program.commands[vm.PC].String()
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// The VM emulator as a script target.  Tick, and the VM emulator's own
+// vmstep, execute a single command.
+////////////////////////////////////////////////////////////////////////////////
+
+// RunVMScript runs a test script against the VM interpreter.
+func RunVMScript(path string) error {
+	return runTestScript(path, &vmTarget{})
+}
+
+type vmTarget struct {
+	vm *VMachine
+}
+
+func (t *vmTarget) load(name string) error {
+	prog, err := LoadVMProgram(name)
+
+	if err != nil {
+		return err
+	}
+
+	t.vm = NewVMachine(prog)
+
+	return nil
+}
+
+func (t *vmTarget) loaded() error {
+	if t.vm == nil {
+		return errors.New("No program loaded")
+	}
+
+	return nil
+}
+
+func (t *vmTarget) command(name string, args []string) (bool, error) {
+	if name != "vmstep" {
+		return false, nil
+	}
+
+	return true, t.tick()
+}
+
+func (t *vmTarget) tick() error {
+	if err := t.loaded(); err != nil {
+		return err
+	}
+
+	t.vm.Step()
+
+	return t.vm.Err()
+}
+
+func (t *vmTarget) tock() error {
+	return nil
+}
+
+func (t *vmTarget) eval() error {
+	return nil
+}
+
+// Registers are known by their VM names; sp, local, argument, this and
+// that.  Segments can be indexed, e.g. local[2], as can RAM.
+var vmRegisterNames = map[string]int{
+	"sp":       vmSP,
+	"local":    vmLCL,
+	"argument": vmARG,
+	"this":     vmTHIS,
+	"that":     vmTHAT,
+}
+
+func (t *vmTarget) variable(name string) (int, error) {
+	if err := t.loaded(); err != nil {
+		return 0, err
+	}
+
+	if r, ok := vmRegisterNames[name]; ok {
+		return r, nil
+	}
+
+	open := strings.Index(name, "[")
+
+	if open == -1 || !strings.HasSuffix(name, "]") {
+		return 0, fmt.Errorf("Unknown variable: %s", name)
+	}
+
+	i, err := strconv.Atoi(name[open+1 : len(name)-1])
+
+	if err != nil || i < 0 {
+		return 0, fmt.Errorf("Invalid index: %s", name)
+	}
+
+	segment := name[:open]
+
+	if segment == "RAM" {
+		if i >= ramSize {
+			return 0, fmt.Errorf("Invalid index: %s", name)
+		}
+		return i, nil
+	}
+
+	if segment == "static" || segment == "constant" || !vmSegments[segment] {
+		return 0, fmt.Errorf("Unknown variable: %s", name)
+	}
+
+	return t.vm.address(segment, i)
+}
+
+func (t *vmTarget) get(name string) (int, error) {
+	addr, err := t.variable(name)
+
+	if err != nil {
+		return 0, err
+	}
+
+	return int(t.vm.RAM[addr]), nil
+}
+
+func (t *vmTarget) set(name string, value int) error {
+	addr, err := t.variable(name)
+
+	if err != nil {
+		return err
+	}
+
+	t.vm.RAM[addr] = int16(value)
+
+	return nil
+}
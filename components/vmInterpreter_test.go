@@ -0,0 +1,120 @@
+package components
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestVMScript(t *testing.T) {
+	if err := RunVMScript("testdata/vm/SimpleAdd.tst"); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestVMFunctions(t *testing.T) {
+	prog, err := LoadVMProgram("testdata/vm/Fib")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	vm := NewVMachine(prog)
+
+	// fibonacci(n-2) is called first, so Sys.init, 6, 4, 2, 0
+	for len(vm.CallStack()) < 5 && !vm.Halted() {
+		vm.Step()
+	}
+
+	stack := vm.CallStack()
+
+	if len(stack) != 5 || stack[0].Function != "Sys.init" || stack[4].Function != "Main.fibonacci" {
+		t.Fatalf("Unexpected call stack: %+v", stack)
+	}
+
+	if arg, _ := vm.Segment("argument", 0); arg != 0 {
+		t.Errorf("Expected fibonacci(0) at the bottom of the calls, got %d", arg)
+	}
+
+	vm.Run(100000)
+
+	if !vm.Halted() || vm.Err() != nil {
+		t.Fatalf("Expected to halt cleanly, error was %v", vm.Err())
+	}
+
+	// Main.0 and Sys.0, in order of first use
+	if vm.RAM[16] != 25 || vm.RAM[17] != 8 {
+		t.Errorf("Expected 25 calls and a result of 8, got %d and %d", vm.RAM[16], vm.RAM[17])
+	}
+
+	if sp := vm.RAM[vmSP]; sp != vmStack+5 {
+		t.Errorf("Expected just Sys.init's frame on the stack, SP is %d", sp)
+	}
+}
+
+var badVM = []struct {
+	source   string
+	expected string
+}{
+	{"push constant", "push expects 2 arguments"},
+	{"push nowhere 1", "Unrecognised segment"},
+	{"pop constant 1", "Cannot pop to constant"},
+	{"push temp 8", "Temp index out of range"},
+	{"goto NOWHERE", "unknown label"},
+	{"wibble", "Unrecognised command"},
+	{"function F 0\nfunction F 0", "defined twice"},
+}
+
+func TestVMErrors(t *testing.T) {
+	for _, tst := range badVM {
+		_, err := ParseVM([]string{"Bad"}, map[string]string{"Bad": tst.source})
+
+		if err == nil || !strings.Contains(err.Error(), tst.expected) {
+			t.Errorf("%q: expected an error containing %q, got %v", tst.source, tst.expected, err)
+		}
+	}
+
+	prog, _ := ParseVM([]string{"Bad"}, map[string]string{"Bad": "call Nope 0"})
+	vm := NewVMachine(prog)
+	vm.Run(10)
+
+	if vm.Err() == nil || !strings.Contains(vm.Err().Error(), "Bad.vm:1") {
+		t.Errorf("Expected an error for calling an undefined function, got %v", vm.Err())
+	}
+
+	// LCL pointed at RAM[2], so there's no frame below it to return to
+	prog, _ = ParseVM([]string{"Bad"}, map[string]string{"Bad": `
+		function Sys.init 0
+		push constant 1
+		pop pointer 1
+		push constant 2
+		pop that 0
+		return`})
+	vm = NewVMachine(prog)
+	vm.Run(10)
+
+	if vm.Err() == nil || !strings.Contains(vm.Err().Error(), "doesn't point at a frame") {
+		t.Errorf("Expected an error for returning without a frame, got %v", vm.Err())
+	}
+}
+
+func TestVMStatics(t *testing.T) {
+	prog, err := ParseVM([]string{"A", "B"}, map[string]string{
+		"A": "function Sys.init 0\npush constant 7\npop static 0\ncall B.f 0\nlabel END\ngoto END",
+		"B": "function B.f 0\npush constant 9\npop static 0\npush constant 0\nreturn",
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	vm := NewVMachine(prog)
+	expected := []int16{0, 0, 7, 0, 0, 9, 9, 7}
+
+	for i, e := range expected {
+		if v, _ := vm.Segment("static", 0); v != e {
+			t.Errorf("After %d commands (%s), expected static 0 to be %d, got %d", i, vm.CurrentFunction(), e, v)
+		}
+
+		vm.Step()
+	}
+}
@@ -0,0 +1,332 @@
+/*
+ Optimisations of VM code, aimed at what the Jack compiler produces.
+ They were asked for on the way from Jack to VM code, but there's no
+ Jack code generation here to do them in (the front end only parses
+ and checks), so they're done on the VM code itself, which has the
+ advantage that they work for anyone's compiler.
+
+ Each pass replaces a run of consecutive commands.  Labels are
+ commands too, so a run never spans somewhere that can be jumped to.
+*/
+
+package components
+
+import "fmt"
+
+// VMOptimisations selects the passes OptimiseVM makes.
+type VMOptimisations struct {
+	Fold     bool // arithmetic on constants, including Math.multiply and Math.divide
+	Reduce   bool // multiplication by small powers of two into additions
+	DeadCode bool // code after a return or goto that can't be reached
+	PushPop  bool // a push immediately popped back to the same place
+}
+
+// Multiplying by more than 2^maxDoublings is left to Math.multiply,
+// past that the additions take more code than they're worth.
+const maxDoublings = 4
+
+// The temp entry strength reduction uses.  The Jack compiler only ever
+// uses temp 0, but other VM code can use any of them, so programs that
+// use this one aren't reduced.
+const reduceTemp = 7
+
+// OptimiseVM returns a copy of prog with the given optimisations
+// made, repeating them until there's nothing left to do.
+func OptimiseVM(prog *VMProgram, opts VMOptimisations) (*VMProgram, error) {
+	passes := []struct {
+		enabled bool
+		pass    func([]vmCommand) ([]vmCommand, bool)
+	}{
+		{opts.Fold, foldConstants},
+		{opts.Reduce && !usesTemp(prog.commands, reduceTemp), reduceStrength},
+		{opts.DeadCode, removeDeadCode},
+		{opts.PushPop, removePushPops},
+	}
+
+	commands := append([]vmCommand(nil), prog.commands...)
+
+	for changed := true; changed; {
+		changed = false
+
+		for _, p := range passes {
+			if p.enabled {
+				var c bool
+				commands, c = p.pass(commands)
+				changed = changed || c
+			}
+		}
+	}
+
+	opt := VMProgram{
+		commands:  commands,
+		functions: make(map[string]int),
+		statics:   prog.statics,
+	}
+
+	if errs := opt.link(); len(errs) > 0 {
+		return nil, errs.asError()
+	}
+
+	return &opt, nil
+}
+
+// True if any command pushes or pops temp i.
+func usesTemp(cmds []vmCommand, i int) bool {
+	for _, c := range cmds {
+		if (c.op == vmPUSH || c.op == vmPOP) && c.segment == "temp" && c.arg == i {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Size is the number of commands in the program.
+func (p *VMProgram) Size() int {
+	return len(p.commands)
+}
+
+// A command made by an optimisation, attributed to the one it replaces.
+func (c vmCommand) with(op vmOp, segment string, arg int) vmCommand {
+	made := vmCommand{op: op, segment: segment, arg: arg, file: c.file, lineNum: c.lineNum}
+
+	for name, o := range vmOps {
+		if o == op {
+			made.source = name
+		}
+	}
+
+	if op == vmPUSH || op == vmPOP {
+		made.source = fmt.Sprintf("%s %s %d", made.source, segment, arg)
+	}
+
+	return made
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// Constant folding
+////////////////////////////////////////////////////////////////////////////////
+
+// Constants can only be pushed as 0 to 32767, so the rest are pushed
+// and then negated (or for -32768, inverted).
+func pushConstant(from vmCommand, v int16) []vmCommand {
+	switch {
+	case v >= 0:
+		return []vmCommand{from.with(vmPUSH, "constant", int(v))}
+	case v == -32768:
+		return []vmCommand{from.with(vmPUSH, "constant", 32767), from.with(vmNOT, "", 0)}
+	}
+
+	return []vmCommand{from.with(vmPUSH, "constant", int(-v)), from.with(vmNEG, "", 0)}
+}
+
+// The value of the constant at cmds[i], and how many commands it takes.
+func constantAt(cmds []vmCommand, i int) (int16, int, bool) {
+	if i >= len(cmds) || cmds[i].op != vmPUSH || cmds[i].segment != "constant" {
+		return 0, 0, false
+	}
+
+	v := int16(cmds[i].arg)
+
+	if i+1 < len(cmds) {
+		switch cmds[i+1].op {
+		case vmNEG:
+			return -v, 2, true
+		case vmNOT:
+			return ^v, 2, true
+		}
+	}
+
+	return v, 1, true
+}
+
+// The result of the binary operation (or call) c, if it can be worked
+// out at compile time.
+func foldBinary(c vmCommand, x, y int16) (int16, bool) {
+	switch c.op {
+	case vmADD, vmSUB, vmEQ, vmGT, vmLT, vmAND, vmOR:
+		return vmBinary(c.op, x, y), true
+	case vmCALL:
+		switch {
+		case c.name == "Math.multiply" && c.arg == 2:
+			return x * y, true
+		case c.name == "Math.divide" && c.arg == 2 && y != 0:
+			return x / y, true
+		}
+	}
+
+	return 0, false
+}
+
+func foldConstants(cmds []vmCommand) ([]vmCommand, bool) {
+	var out []vmCommand
+	changed := false
+
+	for i := 0; i < len(cmds); i++ {
+		x, xLen, ok := constantAt(cmds, i)
+
+		if !ok {
+			out = append(out, cmds[i])
+			continue
+		}
+
+		// x y op
+		if y, yLen, ok := constantAt(cmds, i+xLen); ok && i+xLen+yLen < len(cmds) {
+			op := cmds[i+xLen+yLen]
+
+			if v, ok := foldBinary(op, x, y); ok {
+				out = append(out, pushConstant(op, v)...)
+				i += xLen + yLen
+				changed = true
+				continue
+			}
+		}
+
+		// x op, if it's shorter; push constant 1, neg is already as
+		// short as it gets
+		if i+xLen < len(cmds) {
+			op := cmds[i+xLen]
+
+			if op.op == vmNEG || op.op == vmNOT {
+				v := -x
+				if op.op == vmNOT {
+					v = ^x
+				}
+
+				if folded := pushConstant(op, v); len(folded) < xLen+1 {
+					out = append(out, folded...)
+					i += xLen
+					changed = true
+					continue
+				}
+			}
+		}
+
+		out = append(out, cmds[i])
+	}
+
+	return out, changed
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// Strength reduction
+////////////////////////////////////////////////////////////////////////////////
+
+// x * 2^n becomes n lots of x + x, and x * 1 and x / 1 just x.
+//
+// x / 2^n is deliberately left to Math.divide.  Hack has no shift, so
+// it'd still be a loop, and halving rounds negative numbers down where
+// Math.divide rounds them towards zero (-3 / 2 is -1, not -2).  It'd
+// only be right for an x known not to be negative, which the VM code
+// doesn't say.
+//
+// The doublings go through temp 7, so OptimiseVM doesn't make this pass
+// over a program that uses temp 7 itself.
+func reduceStrength(cmds []vmCommand) ([]vmCommand, bool) {
+	var out []vmCommand
+	changed := false
+
+	for i := 0; i < len(cmds); i++ {
+		c := cmds[i]
+
+		if i+1 >= len(cmds) || c.op != vmPUSH || c.segment != "constant" ||
+			cmds[i+1].op != vmCALL || cmds[i+1].arg != 2 {
+			out = append(out, c)
+			continue
+		}
+
+		call := cmds[i+1]
+		doublings := powerOfTwo(c.arg)
+
+		switch {
+		case c.arg == 1 && (call.name == "Math.multiply" || call.name == "Math.divide"):
+			// nothing to do
+
+		case call.name == "Math.multiply" && doublings > 0 && doublings <= maxDoublings:
+			for d := 0; d < doublings; d++ {
+				out = append(out,
+					call.with(vmPOP, "temp", reduceTemp),
+					call.with(vmPUSH, "temp", reduceTemp),
+					call.with(vmPUSH, "temp", reduceTemp),
+					call.with(vmADD, "", 0))
+			}
+
+		default:
+			out = append(out, c)
+			continue
+		}
+
+		i++
+		changed = true
+	}
+
+	return out, changed
+}
+
+// n if x is 2^n, otherwise -1.
+func powerOfTwo(x int) int {
+	for n := 0; 1<<uint(n) <= x; n++ {
+		if 1<<uint(n) == x {
+			return n
+		}
+	}
+
+	return -1
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// Dead code, and pushes that are popped straight back
+////////////////////////////////////////////////////////////////////////////////
+
+// Nothing after a return or goto can be reached until the next label
+// or function.  A goto to the very next command isn't needed either.
+func removeDeadCode(cmds []vmCommand) ([]vmCommand, bool) {
+	var out []vmCommand
+	changed := false
+	dead := false
+
+	for i, c := range cmds {
+		if c.op == vmLABEL || c.op == vmFUNCTION {
+			dead = false
+		}
+
+		if dead {
+			changed = true
+			continue
+		}
+
+		if c.op == vmGOTO && i+1 < len(cmds) && cmds[i+1].op == vmLABEL && cmds[i+1].name == c.name {
+			changed = true
+			continue
+		}
+
+		out = append(out, c)
+		dead = c.op == vmRETURN || c.op == vmGOTO
+	}
+
+	return out, changed
+}
+
+// push x followed by pop x leaves everything as it was.
+func removePushPops(cmds []vmCommand) ([]vmCommand, bool) {
+	var out []vmCommand
+	changed := false
+
+	for i := 0; i < len(cmds); i++ {
+		c := cmds[i]
+
+		if i+1 < len(cmds) && c.op == vmPUSH && c.segment != "constant" {
+			next := cmds[i+1]
+
+			if next.op == vmPOP && next.segment == c.segment && next.arg == c.arg && next.file == c.file {
+				i++
+				changed = true
+				continue
+			}
+		}
+
+		out = append(out, c)
+	}
+
+	return out, changed
+}
@@ -0,0 +1,136 @@
+package components
+
+import (
+	"strings"
+	"testing"
+)
+
+var vmOptimisations = []struct {
+	opts     VMOptimisations
+	source   string
+	expected string
+}{
+	{VMOptimisations{Fold: true},
+		"push constant 2\npush constant 3\nadd\npush constant 4\ncall Math.multiply 2",
+		"push constant 20"},
+	{VMOptimisations{Fold: true},
+		"push constant 2\npush constant 3\nsub\npush constant 0\nnot\nand",
+		"push constant 1\nneg"},
+	{VMOptimisations{Fold: true},
+		"push constant 1\npush constant 0\ncall Math.divide 2",
+		"push constant 1\npush constant 0\ncall Math.divide 2"},
+	{VMOptimisations{Reduce: true},
+		"push local 0\npush constant 4\ncall Math.multiply 2\npush constant 1\ncall Math.divide 2",
+		"push local 0\npop temp 7\npush temp 7\npush temp 7\nadd\npop temp 7\npush temp 7\npush temp 7\nadd"},
+	{VMOptimisations{Reduce: true},
+		"push local 0\npush constant 32\ncall Math.multiply 2",
+		"push local 0\npush constant 32\ncall Math.multiply 2"},
+	// the program's own temp 7 would be overwritten
+	{VMOptimisations{Reduce: true},
+		"push constant 5\npop temp 7\npush local 0\npush constant 4\ncall Math.multiply 2\npush temp 7\nadd",
+		"push constant 5\npop temp 7\npush local 0\npush constant 4\ncall Math.multiply 2\npush temp 7\nadd"},
+	// division by powers of two is left alone on purpose, see reduceStrength
+	{VMOptimisations{Reduce: true},
+		"push local 0\npush constant 4\ncall Math.divide 2",
+		"push local 0\npush constant 4\ncall Math.divide 2"},
+	{VMOptimisations{DeadCode: true},
+		"function f 0\npush constant 0\nreturn\npush constant 1\nlabel A\ngoto B\nlabel B\ngoto A\npop temp 0",
+		"function f 0\npush constant 0\nreturn\nlabel A\nlabel B\ngoto A"},
+	{VMOptimisations{PushPop: true},
+		"push local 1\npop local 1\npush local 1\npop local 2\npush constant 1\npop temp 0",
+		"push local 1\npop local 2\npush constant 1\npop temp 0"},
+}
+
+func TestVMOptimisations(t *testing.T) {
+	for _, test := range vmOptimisations {
+		prog, err := ParseVM([]string{"Test"}, map[string]string{"Test": test.source})
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		opt, err := OptimiseVM(prog, test.opts)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var got []string
+
+		for _, c := range opt.commands {
+			got = append(got, c.source)
+		}
+
+		if strings.Join(got, "\n") != test.expected {
+			t.Errorf("%q: expected\n%s\ngot\n%s", test.source, test.expected, strings.Join(got, "\n"))
+		}
+	}
+}
+
+// Optimised programs must do the same thing as the originals.
+func TestVMOptimisedRuns(t *testing.T) {
+	all := VMOptimisations{Fold: true, Reduce: true, DeadCode: true, PushPop: true}
+	source := `function Main.main 1
+push constant 3
+push constant 4
+call Math.multiply 2
+pop local 0
+push local 0
+push constant 8
+call Math.multiply 2
+pop local 0
+push local 0
+pop local 0
+push local 0
+call Output.printInt 1
+pop temp 0
+push constant 0
+return
+push constant 99
+call Output.printInt 1
+`
+
+	prog, err := ParseVM([]string{"Main"}, map[string]string{"Main": source})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	opt, err := OptimiseVM(prog, all)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, c := range opt.commands {
+		if c.op == vmCALL && c.name == "Math.multiply" {
+			t.Errorf("Expected the multiplications to be optimised away, got %s", c.source)
+		}
+	}
+
+	for _, p := range []*VMProgram{prog, opt} {
+		vm := NewVMachine(p)
+		vm.Run(1000)
+
+		if console := vm.Console(); vm.Err() != nil || console[0] != "96" {
+			t.Errorf("Expected 96, got %q (error %v)", console[0], vm.Err())
+		}
+	}
+
+	fib, err := LoadVMProgram("testdata/vm/Fib")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if opt, err = OptimiseVM(fib, all); err != nil {
+		t.Fatal(err)
+	}
+
+	vm := NewVMachine(opt)
+	vm.Run(100000)
+
+	if vm.RAM[16] != 25 || vm.RAM[17] != 8 {
+		t.Errorf("Expected 25 calls and a result of 8, got %d and %d", vm.RAM[16], vm.RAM[17])
+	}
+}
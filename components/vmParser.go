@@ -0,0 +1,359 @@
+/*
+ Parser for VM code (chapters 7 and 8).  Each line is a single command,
+ so as with the HDL there's no need for anything as grand as the
+ assembler's lexer.
+*/
+
+package components
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+type vmOp int
+
+const (
+	vmPUSH vmOp = iota
+	vmPOP
+	vmADD
+	vmSUB
+	vmNEG
+	vmEQ
+	vmGT
+	vmLT
+	vmAND
+	vmOR
+	vmNOT
+	vmLABEL
+	vmGOTO
+	vmIFGOTO
+	vmFUNCTION
+	vmCALL
+	vmRETURN
+)
+
+var vmOps = map[string]vmOp{
+	"push":     vmPUSH,
+	"pop":      vmPOP,
+	"add":      vmADD,
+	"sub":      vmSUB,
+	"neg":      vmNEG,
+	"eq":       vmEQ,
+	"gt":       vmGT,
+	"lt":       vmLT,
+	"and":      vmAND,
+	"or":       vmOR,
+	"not":      vmNOT,
+	"label":    vmLABEL,
+	"goto":     vmGOTO,
+	"if-goto":  vmIFGOTO,
+	"function": vmFUNCTION,
+	"call":     vmCALL,
+	"return":   vmRETURN,
+}
+
+var vmSegments = map[string]bool{
+	"argument": true,
+	"local":    true,
+	"static":   true,
+	"constant": true,
+	"this":     true,
+	"that":     true,
+	"pointer":  true,
+	"temp":     true,
+}
+
+type vmCommand struct {
+	op      vmOp
+	segment string // push and pop
+	name    string // labels (scoped to their function) and functions
+	arg     int    // segment index, number of locals or arguments
+	target  int    // index of the command jumped to, or of the function called
+	file    string // which file, without the .vm, statics belong to
+	lineNum int
+	source  string
+}
+
+func (c vmCommand) String() string {
+	return fmt.Sprintf("%s.vm:%d: %s", c.file, c.lineNum, c.source)
+}
+
+// VMProgram is one or more .vm files parsed and linked together.
+type VMProgram struct {
+	commands  []vmCommand
+	functions map[string]int // index of each function command
+	statics   []string       // static variables in order of first use, e.g. Main.0
+}
+
+// LoadVMProgram parses one or more .vm files, or directories of them
+// (each in name order), as a single program.  This is how the OS's
+// own .vm files are used in place of the built in OS.
+func LoadVMProgram(paths ...string) (*VMProgram, error) {
+	files, err := sourceFiles(".vm", paths)
+
+	if err != nil {
+		return nil, err
+	}
+
+	sources := make(map[string]string)
+	var names []string
+
+	for _, f := range files {
+		b, err := ioutil.ReadFile(f)
+
+		if err != nil {
+			return nil, err
+		}
+
+		name := strings.TrimSuffix(filepath.Base(f), filepath.Ext(f))
+
+		if _, dupe := sources[name]; dupe {
+			return nil, fmt.Errorf("More than one %s.vm", name)
+		}
+
+		sources[name] = string(b)
+		names = append(names, name)
+	}
+
+	return ParseVM(names, sources)
+}
+
+// Each of paths if it's a file, or the files in it with the given
+// extension (in name order) if it's a directory.
+func sourceFiles(ext string, paths []string) ([]string, error) {
+	var files []string
+
+	for _, path := range paths {
+		info, err := os.Stat(path)
+
+		if err != nil {
+			return nil, err
+		}
+
+		if !info.IsDir() {
+			files = append(files, path)
+			continue
+		}
+
+		found, err := filepath.Glob(filepath.Join(path, "*"+ext))
+
+		if err != nil {
+			return nil, err
+		}
+
+		if len(found) == 0 {
+			return nil, fmt.Errorf("No %s files in %s", ext, path)
+		}
+
+		sort.Strings(found)
+		files = append(files, found...)
+	}
+
+	return files, nil
+}
+
+// ParseVM parses and links the given sources, keyed by file name
+// (without .vm), in the order given by names.
+func ParseVM(names []string, sources map[string]string) (*VMProgram, error) {
+	prog := VMProgram{functions: make(map[string]int)}
+	var errs errorList
+
+	for _, name := range names {
+		errs = append(errs, prog.parseFile(name, sources[name])...)
+	}
+
+	if len(errs) == 0 {
+		errs = prog.link()
+	}
+
+	if len(errs) > 0 {
+		return nil, errs.asError()
+	}
+
+	return &prog, nil
+}
+
+// The function the program is bootstrapped with; Sys.init if there
+// is one, otherwise Main.main, which is what the built in OS's
+// Sys.init would call.  Empty if there's neither.
+func (p *VMProgram) entryPoint() string {
+	for _, f := range []string{"Sys.init", "Main.main"} {
+		if _, ok := p.functions[f]; ok {
+			return f
+		}
+	}
+
+	return ""
+}
+
+func (p *VMProgram) parseFile(file, source string) errorList {
+	var errs errorList
+	function := ""
+
+	for i, line := range strings.Split(source, "\n") {
+		if c := strings.Index(line, "//"); c != -1 {
+			line = line[:c]
+		}
+
+		line = strings.TrimSpace(line)
+
+		if line == "" {
+			continue
+		}
+
+		cmd, err := parseVMCommand(line)
+
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s.vm:%d: %s", file, i+1, err))
+			continue
+		}
+
+		cmd.file = file
+		cmd.lineNum = i + 1
+		cmd.source = line
+
+		switch cmd.op {
+		case vmFUNCTION:
+			function = cmd.name
+
+		case vmLABEL, vmGOTO, vmIFGOTO:
+			cmd.name = function + "$" + cmd.name
+
+		case vmPUSH, vmPOP:
+			if cmd.segment == "static" {
+				p.addStatic(fmt.Sprintf("%s.%d", file, cmd.arg))
+			}
+		}
+
+		p.commands = append(p.commands, cmd)
+	}
+
+	return errs
+}
+
+func (p *VMProgram) addStatic(name string) {
+	for _, s := range p.statics {
+		if s == name {
+			return
+		}
+	}
+
+	p.statics = append(p.statics, name)
+}
+
+func parseVMCommand(line string) (vmCommand, error) {
+	words := strings.Fields(line)
+	op, ok := vmOps[words[0]]
+
+	if !ok {
+		return vmCommand{}, fmt.Errorf("Unrecognised command: %s", words[0])
+	}
+
+	cmd := vmCommand{op: op}
+	args := words[1:]
+
+	expected := 0
+
+	switch op {
+	case vmPUSH, vmPOP, vmFUNCTION, vmCALL:
+		expected = 2
+	case vmLABEL, vmGOTO, vmIFGOTO:
+		expected = 1
+	}
+
+	if len(args) != expected {
+		return cmd, fmt.Errorf("%s expects %d arguments: %s", words[0], expected, line)
+	}
+
+	switch op {
+	case vmPUSH, vmPOP:
+		if !vmSegments[args[0]] {
+			return cmd, fmt.Errorf("Unrecognised segment: %s", args[0])
+		}
+
+		cmd.segment = args[0]
+
+	case vmFUNCTION, vmCALL, vmLABEL, vmGOTO, vmIFGOTO:
+		cmd.name = args[0]
+	}
+
+	if expected == 2 {
+		n, err := strconv.Atoi(args[1])
+
+		if err != nil || n < 0 || n > 32767 {
+			return cmd, fmt.Errorf("Invalid number: %s", args[1])
+		}
+
+		cmd.arg = n
+	}
+
+	return cmd, checkSegmentIndex(cmd)
+}
+
+func checkSegmentIndex(cmd vmCommand) error {
+	switch {
+	case cmd.op == vmPOP && cmd.segment == "constant":
+		return fmt.Errorf("Cannot pop to constant")
+	case cmd.segment == "pointer" && cmd.arg > 1:
+		return fmt.Errorf("Pointer index out of range: %d", cmd.arg)
+	case cmd.segment == "temp" && cmd.arg > 7:
+		return fmt.Errorf("Temp index out of range: %d", cmd.arg)
+	}
+
+	return nil
+}
+
+// Resolves jump targets to command indexes.  Calls to functions that
+// aren't defined are left with a target of -1, they may be built in.
+func (p *VMProgram) link() errorList {
+	var errs errorList
+	labels := make(map[string]int)
+
+	for i, c := range p.commands {
+		switch c.op {
+		case vmFUNCTION:
+			if _, dupe := p.functions[c.name]; dupe {
+				errs = append(errs, fmt.Errorf("%s: function %s defined twice", c, c.name))
+			}
+			p.functions[c.name] = i
+
+		case vmLABEL:
+			if _, dupe := labels[c.name]; dupe {
+				errs = append(errs, fmt.Errorf("%s: label defined twice", c))
+			}
+			labels[c.name] = i
+		}
+	}
+
+	for i := range p.commands {
+		c := &p.commands[i]
+
+		switch c.op {
+		case vmGOTO, vmIFGOTO:
+			target, ok := labels[c.name]
+
+			if !ok {
+				errs = append(errs, fmt.Errorf("%s: unknown label", c))
+			}
+
+			c.target = target
+
+		case vmCALL:
+			target, ok := p.functions[c.name]
+
+			if !ok {
+				target = -1
+			}
+
+			c.target = target
+		}
+	}
+
+	return errs
+}
@@ -0,0 +1,391 @@
+/*
+ Translates VM code to Hack assembly, using the standard mapping from
+ chapters 7 and 8.  The plain translation is the reference the VM
+ interpreter is checked against, so it deliberately does nothing
+ clever.
+
+ The compact translation is for programs (i.e. anything using the OS)
+ that are too big for ROM otherwise.  Calls, returns and comparisons
+ jump to a single shared copy of their code, passing what they need
+ in D and R13-R15, and the common pushes and pops use shorter forms.
+*/
+
+package components
+
+import (
+	"fmt"
+	"strings"
+)
+
+// TranslateVM returns the plain assembly for prog.  If prog has a
+// Sys.init (or failing that a Main.main) the bootstrap code (SP=256,
+// call Sys.init, halt if it ever returns) comes first.
+func TranslateVM(prog *VMProgram) string {
+	return translateVM(prog, false)
+}
+
+// TranslateVMCompact returns the compact assembly for prog, which
+// behaves the same as TranslateVM's but takes far less ROM.
+func TranslateVMCompact(prog *VMProgram) string {
+	return translateVM(prog, true)
+}
+
+func translateVM(prog *VMProgram, compact bool) string {
+	t := vmTranslator{compact: compact, routines: make(map[string]bool)}
+
+	if entry := prog.entryPoint(); entry != "" {
+		t.comment("bootstrap")
+		t.emit("@256", "D=A", "@SP", "M=D")
+		t.call(entry, 0)
+		t.emit("(bootstrap$halt)", "@bootstrap$halt", "0;JMP")
+	}
+
+	for _, c := range prog.commands {
+		t.comment(c.String())
+		t.translate(c)
+	}
+
+	t.sharedRoutines()
+
+	return t.out.String()
+}
+
+type vmTranslator struct {
+	out      strings.Builder
+	function string // current function, for return labels
+	labels   int    // for generating unique labels
+	compact  bool
+	routines map[string]bool // shared routines used by compact code
+}
+
+func (t *vmTranslator) emit(lines ...string) {
+	for _, l := range lines {
+		t.out.WriteString(l)
+		t.out.WriteString("\n")
+	}
+}
+
+func (t *vmTranslator) comment(s string) {
+	t.emit("// " + s)
+}
+
+// A label unique to this program, e.g. Main.main$ret.3
+func (t *vmTranslator) newLabel(kind string) string {
+	t.labels++
+
+	return fmt.Sprintf("%s$%s.%d", t.function, kind, t.labels)
+}
+
+var vmSegmentRegisters = map[string]string{
+	"local":    "LCL",
+	"argument": "ARG",
+	"this":     "THIS",
+	"that":     "THAT",
+}
+
+var vmBinaryComps = map[vmOp]string{
+	vmADD: "M=D+M",
+	vmSUB: "M=M-D",
+	vmAND: "M=D&M",
+	vmOR:  "M=D|M",
+}
+
+var vmCompareJumps = map[vmOp]string{
+	vmEQ: "D;JEQ",
+	vmGT: "D;JGT",
+	vmLT: "D;JLT",
+}
+
+var vmCompareRoutines = map[vmOp]string{
+	vmEQ: "eq",
+	vmGT: "gt",
+	vmLT: "lt",
+}
+
+func (t *vmTranslator) translate(c vmCommand) {
+	switch c.op {
+	case vmPUSH:
+		t.push(c)
+
+	case vmPOP:
+		t.pop(c)
+
+	case vmADD, vmSUB, vmAND, vmOR:
+		t.emit("@SP", "AM=M-1", "D=M", "A=A-1", vmBinaryComps[c.op])
+
+	case vmNEG:
+		t.emit("@SP", "A=M-1", "M=-M")
+
+	case vmNOT:
+		t.emit("@SP", "A=M-1", "M=!M")
+
+	case vmEQ, vmGT, vmLT:
+		if t.compact {
+			t.jumpToRoutine(vmCompareRoutines[c.op])
+			break
+		}
+
+		done := t.newLabel("cmp")
+		t.emit("@SP", "AM=M-1", "D=M", "A=A-1", "D=M-D", "M=-1",
+			"@"+done, vmCompareJumps[c.op],
+			"@SP", "A=M-1", "M=0",
+			"("+done+")")
+
+	case vmLABEL:
+		t.emit("(" + c.name + ")")
+
+	case vmGOTO:
+		t.emit("@"+c.name, "0;JMP")
+
+	case vmIFGOTO:
+		t.emit("@SP", "AM=M-1", "D=M", "@"+c.name, "D;JNE")
+
+	case vmFUNCTION:
+		t.function = c.name
+		t.emit("(" + c.name + ")")
+
+		if t.compact && c.arg > 0 {
+			t.zeroLocals(c.arg)
+			break
+		}
+
+		for i := 0; i < c.arg; i++ {
+			t.emit("@SP", "A=M", "M=0", "@SP", "M=M+1")
+		}
+
+	case vmCALL:
+		t.call(c.name, c.arg)
+
+	case vmRETURN:
+		if t.compact {
+			t.routines["return"] = true
+			t.emit("@vm$return", "0;JMP")
+			break
+		}
+
+		t.ret()
+	}
+}
+
+// Pushes D
+func (t *vmTranslator) pushD() {
+	if t.compact {
+		t.emit("@SP", "M=M+1", "A=M-1", "M=D")
+		return
+	}
+
+	t.emit("@SP", "A=M", "M=D", "@SP", "M=M+1")
+}
+
+func (t *vmTranslator) push(c vmCommand) {
+	if t.compact && t.compactPush(c) {
+		return
+	}
+
+	switch c.segment {
+	case "constant":
+		t.emit(fmt.Sprintf("@%d", c.arg), "D=A")
+
+	case "local", "argument", "this", "that":
+		t.emit(fmt.Sprintf("@%d", c.arg), "D=A", "@"+vmSegmentRegisters[c.segment], "A=D+M", "D=M")
+
+	default:
+		t.emit("@"+t.fixedAddress(c), "D=M")
+	}
+
+	t.pushD()
+}
+
+func (t *vmTranslator) pop(c vmCommand) {
+	if t.compact && t.compactPop(c) {
+		return
+	}
+
+	switch c.segment {
+	case "local", "argument", "this", "that":
+		t.emit(fmt.Sprintf("@%d", c.arg), "D=A", "@"+vmSegmentRegisters[c.segment], "D=D+M", "@R13", "M=D",
+			"@SP", "AM=M-1", "D=M", "@R13", "A=M", "M=D")
+
+	default:
+		t.emit("@SP", "AM=M-1", "D=M", "@"+t.fixedAddress(c), "M=D")
+	}
+}
+
+// Address (or symbol) of temp, pointer and static entries.
+func (t *vmTranslator) fixedAddress(c vmCommand) string {
+	switch c.segment {
+	case "temp":
+		return fmt.Sprintf("%d", vmTemp+c.arg)
+	case "pointer":
+		return fmt.Sprintf("%d", vmTHIS+c.arg)
+	}
+
+	return fmt.Sprintf("%s.%d", c.file, c.arg)
+}
+
+func (t *vmTranslator) call(function string, args int) {
+	if t.compact {
+		t.compactCall(function, args)
+		return
+	}
+
+	ret := t.newLabel("ret")
+
+	t.emit("@"+ret, "D=A")
+	t.pushD()
+
+	for _, r := range []string{"LCL", "ARG", "THIS", "THAT"} {
+		t.emit("@"+r, "D=M")
+		t.pushD()
+	}
+
+	t.emit("@SP", "D=M", fmt.Sprintf("@%d", args+5), "D=D-A", "@ARG", "M=D",
+		"@SP", "D=M", "@LCL", "M=D",
+		"@"+function, "0;JMP",
+		"("+ret+")")
+}
+
+// R13 holds the frame, R14 the return address.
+func (t *vmTranslator) ret() {
+	t.emit("@LCL", "D=M", "@R13", "M=D",
+		"@5", "A=D-A", "D=M", "@R14", "M=D",
+		"@SP", "AM=M-1", "D=M", "@ARG", "A=M", "M=D",
+		"@ARG", "D=M+1", "@SP", "M=D")
+
+	for _, r := range []string{"THAT", "THIS", "ARG", "LCL"} {
+		t.emit("@R13", "AM=M-1", "D=M", "@"+r, "M=D")
+	}
+
+	t.emit("@R14", "A=M", "0;JMP")
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// Compact translation
+////////////////////////////////////////////////////////////////////////////////
+
+// Constants the ALU can produce without loading A.
+var vmALUConstants = map[int]string{0: "0", 1: "1"}
+
+// Locals at offsets up to here are reached with A=A+1 rather than by
+// adding the offset.
+const maxInlineOffset = 3
+
+// Shorter forms of push, returns false if there isn't one.
+func (t *vmTranslator) compactPush(c vmCommand) bool {
+	switch c.segment {
+	case "constant":
+		if k, ok := vmALUConstants[c.arg]; ok {
+			t.emit("@SP", "M=M+1", "A=M-1", "M="+k)
+			return true
+		}
+
+	case "local", "argument", "this", "that":
+		if c.arg <= maxInlineOffset {
+			t.emit("@"+vmSegmentRegisters[c.segment], "A=M")
+			t.incrementA(c.arg)
+			t.emit("D=M")
+			t.pushD()
+			return true
+		}
+	}
+
+	return false
+}
+
+// Shorter forms of pop, returns false if there isn't one.
+func (t *vmTranslator) compactPop(c vmCommand) bool {
+	switch c.segment {
+	case "local", "argument", "this", "that":
+		if c.arg <= maxInlineOffset {
+			t.emit("@SP", "AM=M-1", "D=M", "@"+vmSegmentRegisters[c.segment], "A=M")
+			t.incrementA(c.arg)
+			t.emit("M=D")
+			return true
+		}
+	}
+
+	return false
+}
+
+func (t *vmTranslator) incrementA(n int) {
+	for i := 0; i < n; i++ {
+		t.emit("A=A+1")
+	}
+}
+
+// Zeroes n locals in one pass rather than pushing each.
+func (t *vmTranslator) zeroLocals(n int) {
+	if n == 1 {
+		t.emit("@SP", "M=M+1", "A=M-1", "M=0")
+		return
+	}
+
+	t.emit("@SP", "A=M", "M=0")
+
+	for i := 1; i < n; i++ {
+		t.emit("A=A+1", "M=0")
+	}
+
+	t.emit("D=A+1", "@SP", "M=D")
+}
+
+// The shared call routine takes the return address in R13, the
+// function in R14 and the number of arguments + 5 in D.
+func (t *vmTranslator) compactCall(function string, args int) {
+	ret := t.newLabel("ret")
+	t.routines["call"] = true
+
+	t.emit("@"+ret, "D=A", "@R13", "M=D",
+		"@"+function, "D=A", "@R14", "M=D",
+		fmt.Sprintf("@%d", args+5), "D=A",
+		"@vm$call", "0;JMP",
+		"("+ret+")")
+}
+
+// The shared comparison routines take the return address in D.
+func (t *vmTranslator) jumpToRoutine(name string) {
+	ret := t.newLabel("ret")
+	t.routines[name] = true
+
+	t.emit("@"+ret, "D=A", "@vm$"+name, "0;JMP", "("+ret+")")
+}
+
+// Only the routines the program uses, after all of its code.
+func (t *vmTranslator) sharedRoutines() {
+	if t.routines["call"] {
+		t.comment("shared call")
+		t.emit("(vm$call)", "@R15", "M=D", "@R13", "D=M")
+		t.pushD()
+
+		for _, r := range []string{"LCL", "ARG", "THIS", "THAT"} {
+			t.emit("@"+r, "D=M")
+			t.pushD()
+		}
+
+		t.emit("@SP", "D=M", "@R15", "D=D-M", "@ARG", "M=D",
+			"@SP", "D=M", "@LCL", "M=D",
+			"@R14", "A=M", "0;JMP")
+	}
+
+	if t.routines["return"] {
+		t.comment("shared return")
+		t.emit("(vm$return)")
+		t.ret()
+	}
+
+	for _, op := range []vmOp{vmEQ, vmGT, vmLT} {
+		name := vmCompareRoutines[op]
+
+		if !t.routines[name] {
+			continue
+		}
+
+		done := "vm$" + name + ".done"
+		t.comment("shared " + name)
+		t.emit("(vm$"+name+")", "@R13", "M=D",
+			"@SP", "AM=M-1", "D=M", "A=A-1", "D=M-D", "M=-1",
+			"@"+done, vmCompareJumps[op],
+			"@SP", "A=M-1", "M=0",
+			"("+done+")", "@R13", "A=M", "0;JMP")
+	}
+}
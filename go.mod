@@ -1,5 +1,5 @@
 module github.com/foggerty/n2t
 
-go 1.14
+go 1.18
 
 require github.com/foggerty/flib v0.0.0-20171205031630-0e97adfeddee
@@ -5,6 +5,8 @@ import (
 	"fmt"
 	"io/ioutil"
 	"os"
+	"path/filepath"
+	"runtime"
 	"strings"
 
 	. "github.com/foggerty/flib"
@@ -13,11 +15,22 @@ import (
 
 var inputFile string
 var outputFile string
+var showUsage bool
+var object bool
+var strip bool
+var cfgFile string
+var batch string
+var workers int
+var compareFile string
 var out *os.File
 
 func main() {
 	defineParams()
 
+	if batch != "" {
+		os.Exit(assembleBatch())
+	}
+
 	AbortIf(
 		func() bool { return strings.Trim(inputFile, "") != "" },
 		func() { showHelp() })
@@ -26,16 +39,44 @@ func main() {
 		func() bool { return checkInput() },
 		func() { fmt.Println("Cannot find input file.") })
 
+	if compareFile != "" {
+		os.Exit(compare())
+	}
+
+	AbortIf(
+		func() bool { return !(object && strip) },
+		func() { fmt.Println("-object and -strip can't be used together, -strip links the program.") })
+
+	AbortIf(
+		func() bool { return !showUsage || !(object || strip) },
+		func() { fmt.Println("-usage can only be used with the plain assembler, not -object or -strip.") })
+
 	AbortIfErr(
 		func() error { return setOutput() },
 		"Error setting output.",
 		nil)
 
+	assemble := Assemble
+
+	switch {
+	case object:
+		assemble = AssembleObject
+	case strip:
+		assemble = AssembleStripped
+	}
+
 	AbortIfErr(
-		func() error { return Assemble(inputFile, out) },
+		func() error { return assemble(inputFile, out) },
 		"Error when assembling.",
 		func() { deleteOutput() })
 
+	if cfgFile != "" {
+		AbortIfErr(
+			func() error { return WriteCFG(inputFile, cfgFile) },
+			"Error writing control flow graph.",
+			nil)
+	}
+
 	out.Sync()
 	out.Close()
 	os.Exit(0)
@@ -54,6 +95,10 @@ func Assemble(in string, out *os.File) error {
 	lexChan	:= components.StartLexingAsm(input)
 	parser	:= components.NewParser(lexChan)
 
+	for _, w := range parser.Warnings {
+		fmt.Fprintln(os.Stderr, "WARNING - "+w)
+	}
+
 	if parser.Error != nil {
 		return parser.Error
 	}
@@ -62,6 +107,10 @@ func Assemble(in string, out *os.File) error {
 		asm, ok := <-parser.Output
 
 		if !ok {
+			if parser.Error == nil && showUsage {
+				fmt.Fprint(os.Stderr, parser.Usage())
+			}
+
 			return parser.Error
 		}
 
@@ -69,10 +118,168 @@ func Assemble(in string, out *os.File) error {
 	}
 }
 
+// AssembleObject will take a Hack assembler file (.asm) and write an
+// object file to out, for n2t-linker.
+func AssembleObject(in string, out *os.File) error {
+	b, err := ioutil.ReadFile(in)
+
+	if err != nil {
+		return err
+	}
+
+	name := strings.TrimSuffix(filepath.Base(in), filepath.Ext(in))
+	obj, err := components.AssembleObject(name, string(b))
+
+	if err != nil {
+		return err
+	}
+
+	return obj.Write(out)
+}
+
+// AssembleStripped is Assemble, less any routines that can't be
+// reached from the start of the program, which are listed on stderr.
+func AssembleStripped(in string, out *os.File) error {
+	b, err := ioutil.ReadFile(in)
+
+	if err != nil {
+		return err
+	}
+
+	name := strings.TrimSuffix(filepath.Base(in), filepath.Ext(in))
+	obj, err := components.AssembleObject(name, string(b))
+
+	if err != nil {
+		return err
+	}
+
+	objects, removed := components.RemoveDeadRoutines([]*components.Object{obj})
+
+	for _, r := range removed {
+		fmt.Fprintf(os.Stderr, "Removed %s\n", r)
+	}
+
+	words, err := components.Link(objects)
+
+	if err != nil {
+		return err
+	}
+
+	return components.WriteHack(out, words)
+}
+
+// WriteCFG writes the control flow graph of a Hack assembler file
+// (.asm) to a Graphviz .dot file.
+func WriteCFG(in, dot string) error {
+	b, err := ioutil.ReadFile(in)
+
+	if err != nil {
+		return err
+	}
+
+	program, err := components.AssembleProgram(string(b))
+
+	if err != nil {
+		return err
+	}
+
+	out, err := os.Create(dot)
+
+	if err != nil {
+		return err
+	}
+
+	if err := program.CFG().WriteDOT(out, nil); err != nil {
+		out.Close()
+		return err
+	}
+
+	return out.Close()
+}
+
+// Assembles everything batch matches, printing a summary, and returns
+// the exit code; 1 if anything failed.
+func assembleBatch() int {
+	var paths []string
+
+	AbortIfErr(
+		func() (err error) {
+			paths, err = components.BatchFiles(batch)
+			return
+		},
+		"Error finding files to assemble.",
+		nil)
+
+	AbortIf(
+		func() bool { return len(paths) > 0 },
+		func() { fmt.Println("No .asm files found.") })
+
+	results := components.AssembleFiles(paths, workers)
+
+	if components.WriteBatchSummary(os.Stdout, results) > 0 {
+		return 1
+	}
+
+	return 0
+}
+
+// Assembles the input and lists where it differs from the reference
+// file, returning the exit code; 1 if there are any differences.
+func compare() int {
+	var program *components.Program
+	var diffs []components.HackDifference
+
+	AbortIfErr(
+		func() error {
+			b, err := ioutil.ReadFile(inputFile)
+
+			if err == nil {
+				program, err = components.AssembleProgram(string(b))
+			}
+
+			return err
+		},
+		"Error when assembling.",
+		nil)
+
+	AbortIfErr(
+		func() error {
+			f, err := os.Open(compareFile)
+
+			if err != nil {
+				return err
+			}
+
+			defer f.Close()
+
+			diffs, err = program.CompareHack(f)
+			return err
+		},
+		"Error reading reference file.",
+		nil)
+
+	program.WriteDifferences(os.Stdout, diffs)
+
+	if len(diffs) > 0 {
+		return 1
+	}
+
+	return 0
+}
+
 func defineParams() {
 	flag.StringVar(&inputFile, "in", "", "Name of the input file.")
 	flag.StringVar(&outputFile, "out", "",
 		"Name of the output file (defaults to name of in, with the extension .hack).\n\nWill overwrite existing files.")
+	flag.BoolVar(&object, "object", false, "Write a relocatable object file for n2t-linker rather than a .hack file.")
+	flag.BoolVar(&strip, "strip", false, "Leave out routines (code under a global label) that can't be reached, listing them on stderr.")
+	flag.StringVar(&cfgFile, "cfg", "", "Also write the program's control flow graph to this Graphviz .dot file.")
+	flag.StringVar(&batch, "batch", "",
+		"Assemble every .asm file under a directory, or matching a glob, writing each .hack next to its source and printing a summary.")
+	flag.IntVar(&workers, "workers", runtime.NumCPU(), "Number of files to assemble at once with -batch.")
+	flag.StringVar(&compareFile, "compare", "",
+		"Compare the assembled program against this reference .hack file, listing each difference, rather than writing it out.")
+	flag.BoolVar(&showUsage, "usage", false, "Print a summary of ROM and RAM usage to stderr.")
 
 	flag.Parse()
 }
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	. "github.com/foggerty/flib"
+	"github.com/foggerty/n2t/components"
+)
+
+var inputFile string
+
+func main() {
+	flag.StringVar(&inputFile, "in", "", "Program to debug; an .asm file gives labels, variables and source lines, a .hack file just addresses.")
+	flag.Parse()
+
+	AbortIf(
+		func() bool { return strings.Trim(inputFile, "") != "" },
+		func() { showHelp() })
+
+	computer := components.NewHackComputer()
+	var program *components.Program
+
+	AbortIfErr(
+		func() (err error) {
+			program, err = load(computer)
+			return
+		},
+		"Error loading program.",
+		nil)
+
+	debugger := components.NewDebugger(computer, program, os.Stdout)
+	input := bufio.NewScanner(os.Stdin)
+
+	fmt.Println("Type help for a list of commands.")
+	debugger.Command("list")
+
+	for {
+		fmt.Print("(hdb) ")
+
+		if !input.Scan() {
+			fmt.Println()
+			break
+		}
+
+		quit, err := debugger.Command(input.Text())
+
+		if err != nil {
+			fmt.Println(err)
+		}
+
+		if quit {
+			break
+		}
+	}
+
+	os.Exit(0)
+}
+
+// Only .asm files come with a Program.
+func load(c *components.HackComputer) (*components.Program, error) {
+	if strings.ToLower(filepath.Ext(inputFile)) != ".asm" {
+		return nil, c.LoadFile(inputFile)
+	}
+
+	b, err := ioutil.ReadFile(inputFile)
+
+	if err != nil {
+		return nil, err
+	}
+
+	program, err := components.AssembleProgram(string(b))
+
+	if err != nil {
+		return nil, err
+	}
+
+	c.LoadProgram(program)
+
+	return program, nil
+}
+
+func showHelp() {
+	fmt.Printf("\nNand2Tetris debugger.\n====================\n\n")
+	fmt.Printf("Usage:\n")
+
+	flag.PrintDefaults()
+
+	fmt.Println()
+}
@@ -0,0 +1,234 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	. "github.com/foggerty/flib"
+	"github.com/foggerty/n2t/components"
+)
+
+var inputFile string
+var maxCycles int
+var frameEvery int
+var frameAtHalt bool
+var frameDir string
+var keyFile string
+var traceFile string
+var profileTop int
+var cfgFile string
+
+func main() {
+	defineParams()
+
+	AbortIf(
+		func() bool { return strings.Trim(inputFile, "") != "" },
+		func() { showHelp() })
+
+	computer := components.NewHackComputer()
+	var program *components.Program
+
+	AbortIfErr(
+		func() (err error) {
+			program, err = load(computer)
+			return
+		},
+		"Error loading program.",
+		nil)
+
+	AbortIfErr(
+		func() error { return loadKeys(computer) },
+		"Error loading key script.",
+		nil)
+
+	var profiler *components.Profiler
+
+	AbortIf(
+		func() bool { return cfgFile == "" || program != nil },
+		func() { fmt.Println("A control flow graph needs an .asm file.") })
+
+	if profileTop > 0 || cfgFile != "" {
+		profiler = components.NewProfiler(program)
+		computer.Observe(profiler.Record)
+	}
+
+	AbortIfErr(
+		func() error { return trace(computer, run) },
+		"Error when running.",
+		nil)
+
+	if profileTop > 0 {
+		profiler.WriteReport(os.Stdout, profileTop)
+	}
+
+	if cfgFile != "" {
+		AbortIfErr(
+			func() error { return writeCFG(program, profiler) },
+			"Error writing control flow graph.",
+			nil)
+	}
+
+	os.Exit(0)
+}
+
+// Assembling an .asm file here, rather than leaving it to LoadFile,
+// gives the profiler labels to work with.
+func load(c *components.HackComputer) (*components.Program, error) {
+	if strings.ToLower(filepath.Ext(inputFile)) != ".asm" {
+		return nil, c.LoadFile(inputFile)
+	}
+
+	b, err := ioutil.ReadFile(inputFile)
+
+	if err != nil {
+		return nil, err
+	}
+
+	program, err := components.AssembleProgram(string(b))
+
+	if err != nil {
+		return nil, err
+	}
+
+	c.LoadProgram(program)
+
+	return program, nil
+}
+
+// Writes the program's control flow graph, with the cycles spent in
+// each block.
+func writeCFG(program *components.Program, profiler *components.Profiler) error {
+	out, err := os.Create(cfgFile)
+
+	if err != nil {
+		return err
+	}
+
+	if err := program.CFG().WriteDOT(out, profiler); err != nil {
+		out.Close()
+		return err
+	}
+
+	return out.Close()
+}
+
+// Calls run with tracing turned on, if asked for.
+func trace(c *components.HackComputer, run func(*components.HackComputer) error) error {
+	if traceFile == "" {
+		return run(c)
+	}
+
+	out, err := os.Create(traceFile)
+
+	if err != nil {
+		return err
+	}
+
+	tw := components.NewTraceWriter(out)
+	c.Observe(tw.Record)
+
+	if err := run(c); err != nil {
+		out.Close()
+		return err
+	}
+
+	if err := tw.Flush(); err != nil {
+		out.Close()
+		return err
+	}
+
+	return out.Close()
+}
+
+// Runs until either the program halts or maxCycles is reached,
+// dumping frames along the way if asked to.
+func run(c *components.HackComputer) error {
+	for c.Time < maxCycles && !c.Halted() {
+		c.Step()
+
+		if frameEvery > 0 && c.Time%frameEvery == 0 {
+			if err := writeFrame(c); err != nil {
+				return err
+			}
+		}
+	}
+
+	if c.Halted() {
+		fmt.Printf("Halted after %d cycles.\n", c.Time)
+
+		if frameAtHalt {
+			return writeFrame(c)
+		}
+	} else {
+		fmt.Printf("Stopped after %d cycles.\n", c.Time)
+	}
+
+	return nil
+}
+
+func loadKeys(c *components.HackComputer) error {
+	if keyFile == "" {
+		return nil
+	}
+
+	in, err := os.Open(keyFile)
+
+	if err != nil {
+		return err
+	}
+
+	defer in.Close()
+
+	script, err := components.ParseKeyScript(in)
+
+	if err != nil {
+		return err
+	}
+
+	c.SetKeyScript(script)
+
+	return nil
+}
+
+func writeFrame(c *components.HackComputer) error {
+	name := filepath.Join(frameDir, fmt.Sprintf("frame-%09d.png", c.Time))
+	out, err := os.Create(name)
+
+	if err != nil {
+		return err
+	}
+
+	if err := c.WriteScreenPNG(out); err != nil {
+		out.Close()
+		return err
+	}
+
+	return out.Close()
+}
+
+func defineParams() {
+	flag.StringVar(&inputFile, "in", "", "Name of the program to run (.hack or .asm).")
+	flag.IntVar(&maxCycles, "cycles", 10000000, "Maximum number of cycles to run for.")
+	flag.IntVar(&frameEvery, "frames", 0, "Write the screen to a PNG every n cycles (0 for never).")
+	flag.BoolVar(&frameAtHalt, "halt-frame", false, "Write the screen to a PNG when the program halts.")
+	flag.StringVar(&frameDir, "frame-dir", ".", "Directory to write frames to, named frame-<cycle>.png.")
+	flag.StringVar(&keyFile, "keys", "", "Key script to feed into the keyboard, one '<cycle> <key>' per line.")
+	flag.StringVar(&traceFile, "trace", "", "Write a trace of every cycle (PC, instruction, A, D and any RAM write) to this file.")
+	flag.IntVar(&profileTop, "profile", 0, "Print the n hottest labels and addresses once finished (0 for no profile).")
+	flag.StringVar(&cfgFile, "cfg", "", "Write the control flow graph of an .asm program, with the cycles spent in each block, to this Graphviz .dot file once finished.")
+
+	flag.Parse()
+}
+
+func showHelp() {
+	fmt.Printf("\nNand2Tetris CPU emulator.\n========================\n\n")
+	fmt.Printf("Usage:\n")
+
+	flag.PrintDefaults()
+
+	fmt.Println()
+}
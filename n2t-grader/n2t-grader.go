@@ -0,0 +1,99 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"runtime"
+	"time"
+
+	. "github.com/foggerty/flib"
+	"github.com/foggerty/n2t/components"
+)
+
+var submissionsDir string
+var testsDir string
+var format string
+var outputFile string
+var workers int
+var timeout time.Duration
+
+func main() {
+	defineParams()
+
+	AbortIf(
+		func() bool { return submissionsDir != "" && testsDir != "" },
+		func() { showHelp() })
+
+	AbortIf(
+		func() bool { return format == "csv" || format == "json" },
+		func() { fmt.Println("Format must be csv or json.") })
+
+	var submissions []string
+	var cases []components.TestCase
+
+	AbortIfErr(
+		func() (err error) {
+			submissions, err = components.Submissions(submissionsDir)
+			return
+		},
+		"Error finding submissions.",
+		nil)
+
+	AbortIfErr(
+		func() (err error) {
+			cases, err = components.LoadTestCases(testsDir)
+			return
+		},
+		"Error loading test cases.",
+		nil)
+
+	grades := components.GradeSubmissions(submissions, cases, workers, timeout)
+
+	out := os.Stdout
+
+	if outputFile != "" {
+		AbortIfErr(
+			func() (err error) {
+				out, err = os.Create(outputFile)
+				return
+			},
+			"Error creating output file.",
+			nil)
+	}
+
+	write := components.WriteGradesCSV
+
+	if format == "json" {
+		write = components.WriteGradesJSON
+	}
+
+	AbortIfErr(
+		func() error { return write(out, grades) },
+		"Error writing report.",
+		nil)
+
+	out.Close()
+	os.Exit(0)
+}
+
+func defineParams() {
+	flag.StringVar(&submissionsDir, "submissions", "", "Directory of submissions, each a directory of .asm files or a single .asm file.")
+	flag.StringVar(&testsDir, "tests", "", "Directory of test cases, .tst scripts with their .cmp files, or .in/.expected RAM pairs.")
+	flag.StringVar(&format, "format", "csv", "Report format, csv or json.")
+	flag.StringVar(&outputFile, "out", "", "Name of the report file (defaults to stdout).")
+	flag.IntVar(&workers, "workers", runtime.NumCPU(), "Number of tests to run at once.")
+	flag.DurationVar(&timeout, "timeout", 10*time.Second, "How long each test gets before it's failed.")
+
+	flag.Parse()
+}
+
+func showHelp() {
+	fmt.Printf("\nNand2Tetris autograder.\n=======================\n\n")
+	fmt.Printf("Usage: n2t-grader -submissions dir -tests dir [-format csv|json] [-out report]\n\n")
+	fmt.Printf("Runs every submission against every test case, reporting pass or fail\nand the first mismatch for each.\n\n")
+
+	flag.PrintDefaults()
+
+	fmt.Println()
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	. "github.com/foggerty/flib"
+	"github.com/foggerty/n2t/components"
+)
+
+var outputs components.JackOutputs
+var outputDir string
+var check bool
+
+func main() {
+	flag.BoolVar(&outputs.Tokens, "tokens", false, "Write each class's tokens as XML, to MainT.xml etc.")
+	flag.BoolVar(&outputs.Tree, "xml", false, "Write each class's parse tree as XML, to Main.xml etc.")
+	flag.BoolVar(&outputs.JSON, "json", false, "Write each class's syntax tree as JSON, to Main.json etc.")
+	flag.StringVar(&outputDir, "out", "", "Where to write the XML and JSON files (defaults to alongside each .jack file).")
+	flag.BoolVar(&check, "check", false, "Check the program even when writing XML or JSON.")
+	flag.Parse()
+
+	AbortIf(
+		func() bool { return flag.NArg() > 0 },
+		func() { showHelp() })
+
+	var program *components.JackProgram
+
+	AbortIfErr(
+		func() (err error) {
+			program, err = components.LoadJackProgram(flag.Args()...)
+			return
+		},
+		"Error parsing Jack code.",
+		nil)
+
+	if outputs != (components.JackOutputs{}) {
+		writeOutputs(program)
+
+		if !check {
+			os.Exit(0)
+		}
+	}
+
+	diagnostics := program.Check()
+
+	for _, d := range diagnostics {
+		fmt.Println(d)
+	}
+
+	if len(diagnostics) > 0 {
+		os.Exit(1)
+	}
+
+	os.Exit(0)
+}
+
+func writeOutputs(program *components.JackProgram) {
+	var written []string
+
+	AbortIfErr(
+		func() (err error) {
+			written, err = program.WriteOutputs(outputDir, outputs)
+			return
+		},
+		"Error writing output.",
+		nil)
+
+	for _, path := range written {
+		fmt.Fprintf(os.Stderr, "Wrote %s\n", path)
+	}
+}
+
+func showHelp() {
+	fmt.Printf("\nNand2Tetris Jack checker.\n========================\n\n")
+	fmt.Printf("Usage: n2t-jack [-tokens] [-xml] [-json] [-out dir] [-check] Main.jack ... or dir ...\n\n")
+	fmt.Printf("Checks a Jack program for the mistakes the course's compiler lets through, such as\n")
+	fmt.Printf("undeclared variables, calls with the wrong number of arguments and missing returns,\n")
+	fmt.Printf("each reported as file:line:column: message.  The exit code is 1 if there are any.\n\n")
+	fmt.Printf("-tokens and -xml write project 10's XML (MainT.xml and Main.xml), the same as the\n")
+	fmt.Printf("course's files, instead of checking (unless -check is given too).\n\n")
+
+	flag.PrintDefaults()
+
+	fmt.Println()
+}
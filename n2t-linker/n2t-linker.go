@@ -0,0 +1,110 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	. "github.com/foggerty/flib"
+	"github.com/foggerty/n2t/components"
+)
+
+var outputFile string
+var strip bool
+
+func main() {
+	flag.StringVar(&outputFile, "out", "", "Name of the .hack file to write (defaults to stdout).")
+	flag.BoolVar(&strip, "strip", false, "Leave out routines that can't be reached, listing them on stderr.")
+	flag.Parse()
+
+	AbortIf(
+		func() bool { return flag.NArg() > 0 },
+		func() { showHelp() })
+
+	var objects []*components.Object
+
+	for _, path := range flag.Args() {
+		AbortIfErr(
+			func() error {
+				obj, err := readObject(path)
+				objects = append(objects, obj)
+				return err
+			},
+			"Error reading object file.",
+			nil)
+	}
+
+	out := os.Stdout
+
+	if outputFile != "" {
+		AbortIfErr(
+			func() (err error) {
+				out, err = os.Create(outputFile)
+				return
+			},
+			"Error creating output file.",
+			nil)
+	}
+
+	if strip {
+		objects = stripObjects(objects)
+	}
+
+	AbortIfErr(
+		func() error {
+			words, err := components.Link(objects)
+
+			if err != nil {
+				return err
+			}
+
+			return components.WriteHack(out, words)
+		},
+		"Error when linking.",
+		func() { tidy(out) })
+
+	out.Close()
+	os.Exit(0)
+}
+
+func readObject(path string) (*components.Object, error) {
+	f, err := os.Open(path)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer f.Close()
+
+	return components.ReadObject(f, strings.TrimSuffix(filepath.Base(path), filepath.Ext(path)))
+}
+
+func stripObjects(objects []*components.Object) []*components.Object {
+	stripped, removed := components.RemoveDeadRoutines(objects)
+
+	for _, r := range removed {
+		fmt.Fprintf(os.Stderr, "Removed %s\n", r)
+	}
+
+	return stripped
+}
+
+// Doesn't leave a half written file behind.
+func tidy(out *os.File) {
+	if out != os.Stdout {
+		out.Close()
+		os.Remove(outputFile)
+	}
+}
+
+func showHelp() {
+	fmt.Printf("\nNand2Tetris linker.\n==================\n\n")
+	fmt.Printf("Usage: n2t-linker [-out program.hack] [-strip] main.hobj library.hobj ...\n\n")
+	fmt.Printf("Objects are laid out in the order given, so the first is where execution starts.\n\n")
+
+	flag.PrintDefaults()
+
+	fmt.Println()
+}
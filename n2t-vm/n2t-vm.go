@@ -0,0 +1,181 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	. "github.com/foggerty/flib"
+	"github.com/foggerty/n2t/components"
+)
+
+var inputPath string
+var osPath string
+var maxCommands int
+var maxCycles int
+var diff bool
+var asmPath string
+var compact bool
+var optimisations components.VMOptimisations
+
+func main() {
+	flag.StringVar(&inputPath, "in", "", "A .vm file, or a directory of them.")
+	flag.StringVar(&osPath, "os", "", "A directory of the OS's .vm files, to use instead of the built in OS.")
+	flag.IntVar(&maxCommands, "commands", 10000000, "Maximum number of VM commands to run.")
+	flag.BoolVar(&diff, "diff", false, "Also translate to assembly, run that in the CPU emulator, and compare the results.")
+	flag.IntVar(&maxCycles, "cycles", 100000000, "Maximum number of CPU cycles to run with -diff.")
+	flag.StringVar(&asmPath, "asm", "", "Write the translation to this .asm file, and report its size, rather than running.")
+	flag.BoolVar(&compact, "compact", false, "Use the compact translation (shared call, return and comparison code) for -asm and -diff.")
+	flag.BoolVar(&optimisations.Fold, "fold", false, "Fold arithmetic on constants.")
+	flag.BoolVar(&optimisations.Reduce, "reduce", false, "Turn multiplication by small powers of two into additions.")
+	flag.BoolVar(&optimisations.DeadCode, "dead", false, "Remove code that can't be reached.")
+	flag.BoolVar(&optimisations.PushPop, "pushpop", false, "Remove pushes that are popped straight back.")
+	flag.Parse()
+
+	AbortIf(
+		func() bool { return strings.Trim(inputPath, "") != "" },
+		func() { showHelp() })
+
+	var program *components.VMProgram
+
+	AbortIfErr(
+		func() (err error) {
+			paths := []string{inputPath}
+
+			if osPath != "" {
+				paths = append(paths, osPath)
+			}
+
+			program, err = components.LoadVMProgram(paths...)
+			return
+		},
+		"Error loading VM code.",
+		nil)
+
+	if optimisations != (components.VMOptimisations{}) {
+		program = optimise(program)
+	}
+
+	if asmPath != "" {
+		writeTranslation(program)
+	}
+
+	if diff {
+		diffTranslation(program)
+	}
+
+	vm := components.NewVMachine(program)
+	vm.SetConsole(os.Stdin, os.Stdout)
+	vm.Run(maxCommands)
+
+	AbortIfErr(
+		func() error { return vm.Err() },
+		"Error when running.",
+		func() { showState(vm) })
+
+	showState(vm)
+	os.Exit(0)
+}
+
+func optimise(program *components.VMProgram) *components.VMProgram {
+	var optimised *components.VMProgram
+
+	AbortIfErr(
+		func() (err error) {
+			optimised, err = components.OptimiseVM(program, optimisations)
+			return
+		},
+		"Error when optimising.",
+		nil)
+
+	fmt.Printf("Optimised from %d to %d commands.\n", program.Size(), optimised.Size())
+
+	return optimised
+}
+
+func translator() func(*components.VMProgram) string {
+	if compact {
+		return components.TranslateVMCompact
+	}
+
+	return components.TranslateVM
+}
+
+// Reports the ROM used by both translations, so the difference can
+// be seen.
+func writeTranslation(program *components.VMProgram) {
+	for _, t := range []struct {
+		name      string
+		translate func(*components.VMProgram) string
+	}{
+		{"Plain", components.TranslateVM},
+		{"Compact", components.TranslateVMCompact},
+	} {
+		var assembled *components.Program
+
+		AbortIfErr(
+			func() (err error) {
+				assembled, err = components.AssembleProgram(t.translate(program))
+				return
+			},
+			"Error assembling the translation.",
+			nil)
+
+		fmt.Printf("%-8s %6d words, %5.1f%% of ROM\n", t.name+":", assembled.Size(), float64(assembled.Size())*100/32768)
+	}
+
+	AbortIfErr(
+		func() error { return ioutil.WriteFile(asmPath, []byte(translator()(program)), 0644) },
+		"Error writing the translation.",
+		nil)
+
+	os.Exit(0)
+}
+
+func diffTranslation(program *components.VMProgram) {
+	var result components.VMDiffResult
+
+	AbortIfErr(
+		func() (err error) {
+			result, err = components.DiffVM(program, translator(), maxCommands, maxCycles)
+			return
+		},
+		"Error when comparing with the translation.",
+		nil)
+
+	fmt.Println(result)
+
+	if !result.Same() {
+		os.Exit(1)
+	}
+
+	os.Exit(0)
+}
+
+func showState(vm *components.VMachine) {
+	if vm.Halted() {
+		fmt.Printf("Halted after %d commands.\n", vm.Time)
+	} else {
+		fmt.Printf("Stopped after %d commands.\n", vm.Time)
+	}
+
+	fmt.Printf("Next command: %s\n", vm.Command())
+	fmt.Println("Call stack:")
+
+	for _, f := range vm.CallStack() {
+		fmt.Printf("  %s\n", f.Function)
+	}
+
+	fmt.Printf("Stack: %v\n", vm.Stack())
+}
+
+func showHelp() {
+	fmt.Printf("\nNand2Tetris VM emulator.\n=======================\n\n")
+	fmt.Printf("Usage:\n")
+
+	flag.PrintDefaults()
+
+	fmt.Println()
+}